@@ -21,6 +21,9 @@ import (
 // web服务器默认端口
 const DefaultPort = 5920
 
+// 中断任务后等待任务日志更新的时间
+const interruptWaitTime = 10 * time.Second
+
 var CmdWeb = cli.Command{
 	Name:   "web",
 	Usage:  "run web server",
@@ -109,9 +112,12 @@ func initModule() {
 	// 版本升级
 	upgradeIfNeed()
 
-	// 初始化定时任务
+	// 注册调度器实例, 处理异常退出遗留的任务日志
 	serviceTask := new(service.Task)
-	serviceTask.Initialize()
+	serviceTask.RegisterInstance()
+
+	// 初始化定时任务, 开启主备模式时只有主节点调度任务
+	serviceTask.StartLeaderElection()
 }
 
 // 解析端口
@@ -167,9 +173,10 @@ func setEnvironment(ctx *cli.Context) {
 
 // 捕捉信号
 func catchSignal() {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	// todo 配置热更新, windows 不支持 syscall.SIGUSR1, syscall.SIGUSR2
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	shuttingDown := false
 	for {
 		s := <-c
 		logger.Info("收到信号 -- ", s)
@@ -177,7 +184,13 @@ func catchSignal() {
 		case syscall.SIGHUP:
 			logger.Info("收到终端断开信号, 忽略")
 		case syscall.SIGINT, syscall.SIGTERM:
-			shutdown()
+			// 退出过程中再次收到信号, 立即退出
+			if shuttingDown {
+				logger.Warn("再次收到退出信号, 强制退出")
+				os.Exit(1)
+			}
+			shuttingDown = true
+			go shutdown()
 		}
 	}
 }
@@ -197,22 +210,33 @@ func shutdown() {
 	// 停止所有任务调度
 	logger.Info("停止定时任务调度")
 	serviceTask.StopAll()
+	// 释放主节点租约, 备节点立即接管
+	serviceTask.ResignLeader()
 
 	taskNumInRunning := service.TaskNum.Num()
 	logger.Infof("正在运行的任务有%d个", taskNumInRunning)
 	if taskNumInRunning > 0 {
-		logger.Info("等待所有任务执行完成后退出")
+		logger.Info("等待所有任务执行完成后退出, 再次发送退出信号可强制退出")
 	}
+	timeout := time.Duration(app.Setting.ShutdownTimeout) * time.Second
+	startTime := time.Now()
 	for {
 		if taskNumInRunning <= 0 {
 			break
 		}
-		time.Sleep(3 * time.Second)
+		if timeout > 0 && time.Since(startTime) >= timeout {
+			logger.Warnf("等待任务执行完成超时, 中断正在运行的%d个任务", taskNumInRunning)
+			serviceTask.InterruptAll(interruptWaitTime)
+			break
+		}
+		time.Sleep(1 * time.Second)
 		taskNumInRunning = service.TaskNum.Num()
 	}
 
 	// 释放gRPC连接池
 	grpcpool.Pool.ReleaseAll()
+
+	serviceTask.UnregisterInstance()
 }
 
 // 判断应用是否需要升级, 当存在版本号文件且版本小于app.VersionId时升级
@@ -14,7 +14,7 @@ import (
     "gocron/modules/utils"
 )
 
-const AppVersion = "1.2.2"
+const AppVersion = "1.3.0"
 
 func main()  {
 	var serverAddr string
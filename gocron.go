@@ -10,7 +10,7 @@ import (
     "gocron/cmd"
 )
 
-const AppVersion = "1.2.2"
+const AppVersion = "1.3.0"
 
 func main() {
     app := cli.NewApp()
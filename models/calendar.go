@@ -0,0 +1,170 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+type CalendarDateType int8
+
+const (
+	CalendarDateInclude CalendarDateType = 1 // 包含, 优先级高于排除, 用于调休等特殊工作日
+	CalendarDateExclude CalendarDateType = 2 // 排除, 任务在这些日期不执行
+)
+
+// 日期格式, 按字符串比较即可判断先后
+const CalendarDateFormat = "2006-01-02"
+
+// 日历, 任务引用日历后, 被日历排除的日期不执行
+type Calendar struct {
+	Id        int       `xorm:"int pk autoincr"`
+	Name      string    `xorm:"varchar(64) notnull"`             // 日历名称
+	Remark    string    `xorm:"varchar(100) notnull default ''"` // 备注
+	Created   time.Time `xorm:"datetime notnull created"`        // 创建时间
+	BaseModel `xorm:"-"`
+	Selected  bool `xorm:"-"`
+}
+
+// 日历中包含或排除的日期范围
+type CalendarDate struct {
+	Id         int              `xorm:"int pk autoincr"`
+	CalendarId int              `xorm:"int notnull index"`
+	Type       CalendarDateType `xorm:"tinyint notnull default 2"`       // 1:包含 2:排除
+	StartDate  string           `xorm:"varchar(10) notnull"`             // 开始日期 2006-01-02
+	EndDate    string           `xorm:"varchar(10) notnull"`             // 结束日期, 包含当天
+	Name       string           `xorm:"varchar(128) notnull default ''"` // 名称, 如节假日名称
+}
+
+// 新增
+func (calendar *Calendar) Create() (insertId int, err error) {
+	_, err = Db.Insert(calendar)
+	if err == nil {
+		insertId = calendar.Id
+	}
+
+	return
+}
+
+func (calendar *Calendar) UpdateBean(id int) (int64, error) {
+	return Db.ID(id).Cols("name,remark").Update(calendar)
+}
+
+// 删除日历及其日期
+func (calendar *Calendar) Delete(id int) (int64, error) {
+	_, err := Db.Where("calendar_id = ?", id).Delete(new(CalendarDate))
+	if err != nil {
+		return 0, err
+	}
+
+	return Db.Id(id).Delete(new(Calendar))
+}
+
+func (calendar *Calendar) Find(id int) error {
+	_, err := Db.Id(id).Get(calendar)
+
+	return err
+}
+
+func (calendar *Calendar) NameExists(name string, id int) (bool, error) {
+	if id == 0 {
+		count, err := Db.Where("name = ?", name).Count(calendar)
+		return count > 0, err
+	}
+
+	count, err := Db.Where("name = ? AND id != ?", name, id).Count(calendar)
+	return count > 0, err
+}
+
+func (calendar *Calendar) List(params CommonMap) ([]Calendar, error) {
+	calendar.parsePageAndPageSize(params)
+	list := make([]Calendar, 0)
+	session := Db.Desc("id")
+	calendar.parseWhere(session, params)
+	err := session.Limit(calendar.PageSize, calendar.pageLimitOffset()).Find(&list)
+
+	return list, err
+}
+
+func (calendar *Calendar) AllList() ([]Calendar, error) {
+	list := make([]Calendar, 0)
+	err := Db.Cols("id,name").Desc("id").Find(&list)
+
+	return list, err
+}
+
+func (calendar *Calendar) Total(params CommonMap) (int64, error) {
+	session := Db.NewSession()
+	calendar.parseWhere(session, params)
+	return session.Count(calendar)
+}
+
+// 判断日历是否被任务引用
+func (calendar *Calendar) IdReferenced(id int) (bool, error) {
+	count, err := Db.Where("FIND_IN_SET(?, calendar_ids)", id).Count(new(Task))
+
+	return count > 0, err
+}
+
+// 解析where
+func (calendar *Calendar) parseWhere(session *xorm.Session, params CommonMap) {
+	if len(params) == 0 {
+		return
+	}
+	id, ok := params["Id"]
+	if ok && id.(int) > 0 {
+		session.And("id = ?", id)
+	}
+	name, ok := params["Name"]
+	if ok && name.(string) != "" {
+		session.And("name LIKE ?", "%"+name.(string)+"%")
+	}
+}
+
+func (calendarDate *CalendarDate) Create() (int, error) {
+	_, err := Db.Insert(calendarDate)
+
+	return calendarDate.Id, err
+}
+
+// 批量新增
+func (calendarDate *CalendarDate) BatchCreate(dates []CalendarDate) (int64, error) {
+	if len(dates) == 0 {
+		return 0, nil
+	}
+
+	return Db.Insert(&dates)
+}
+
+func (calendarDate *CalendarDate) Delete(id int) (int64, error) {
+	return Db.Id(id).Delete(new(CalendarDate))
+}
+
+// 获取日历下所有日期
+func (calendarDate *CalendarDate) ListByCalendarId(calendarId int) ([]CalendarDate, error) {
+	list := make([]CalendarDate, 0)
+	err := Db.Where("calendar_id = ?", calendarId).Asc("start_date").Find(&list)
+
+	return list, err
+}
+
+// 获取多个日历中包含指定日期的记录, calendarIds为逗号分隔的日历ID
+func (calendarDate *CalendarDate) Match(calendarIds string, date string) ([]CalendarDate, error) {
+	list := make([]CalendarDate, 0)
+	ids := make([]interface{}, 0)
+	for _, id := range strings.Split(calendarIds, ",") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return list, nil
+	}
+	err := Db.In("calendar_id", ids...).
+		And("start_date <= ? AND end_date >= ?", date, date).
+		Find(&list)
+
+	return list, err
+}
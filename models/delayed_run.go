@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+// 延迟执行, 指定时间后执行一次任务
+type DelayedRun struct {
+	Id        int       `xorm:"int pk autoincr"`
+	TaskId    int       `xorm:"int notnull index"`                // 任务id
+	RunAt     time.Time `xorm:"datetime notnull index"`           // 执行时间
+	Params    string    `xorm:"varchar(1024) notnull default ''"` // 覆盖任务参数默认值(JSON)
+	Status    Status    `xorm:"tinyint notnull index default 1"`  // 状态 1:等待执行 2:已执行 3:已取消
+	Created   time.Time `xorm:"datetime notnull created"`
+	Name      string    `xorm:"-"` // 任务名称
+	BaseModel `xorm:"-"`
+}
+
+func (run *DelayedRun) Create() (insertId int, err error) {
+	_, err = Db.Insert(run)
+	if err == nil {
+		insertId = run.Id
+	}
+
+	return
+}
+
+func (run *DelayedRun) Detail(id int) (DelayedRun, error) {
+	delayedRun := DelayedRun{}
+	_, err := Db.ID(id).Get(&delayedRun)
+
+	return delayedRun, err
+}
+
+// 所有等待执行的记录
+func (run *DelayedRun) PendingList() ([]DelayedRun, error) {
+	list := make([]DelayedRun, 0)
+	err := Db.Where("status = ?", Running).Asc("run_at").Find(&list)
+
+	return list, err
+}
+
+// 标记为已执行, 已执行或已取消返回false
+func (run *DelayedRun) Fire(id int) (bool, error) {
+	return run.changeStatus(id, Finish)
+}
+
+// 取消执行, 已执行或已取消返回false
+func (run *DelayedRun) Cancel(id int) (bool, error) {
+	return run.changeStatus(id, Cancel)
+}
+
+func (run *DelayedRun) changeStatus(id int, status Status) (bool, error) {
+	affected, err := Db.Table(run).Where("id = ? AND status = ?", id, Running).Update(CommonMap{
+		"status": status,
+	})
+
+	return affected > 0, err
+}
+
+func (run *DelayedRun) List(params CommonMap) ([]DelayedRun, error) {
+	run.parsePageAndPageSize(params)
+	list := make([]DelayedRun, 0)
+	session := Db.Alias("d").Join("LEFT", []string{TablePrefix + "task", "t"}, "d.task_id = t.id")
+	run.parseWhere(session, params)
+	err := session.Select("d.*, t.name").Desc("d.id").Limit(run.PageSize, run.pageLimitOffset()).Find(&list)
+
+	return list, err
+}
+
+func (run *DelayedRun) Total(params CommonMap) (int64, error) {
+	session := Db.Alias("d")
+	run.parseWhere(session, params)
+
+	return session.Count(run)
+}
+
+// 解析where
+func (run *DelayedRun) parseWhere(session *xorm.Session, params CommonMap) {
+	if len(params) == 0 {
+		return
+	}
+	taskId, ok := params["TaskId"]
+	if ok && taskId.(int) > 0 {
+		session.And("d.task_id = ?", taskId)
+	}
+	status, ok := params["Status"]
+	if ok && status.(int) > -1 {
+		session.And("d.status = ?", status)
+	}
+}
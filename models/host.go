@@ -11,6 +11,7 @@ type Host struct {
     Alias     string    `xorm:"varchar(32) notnull default '' "`  // 主机别名
     Port      int       `xorm:"notnull default 22"`               // 主机端口
     Remark    string    `xorm:"varchar(100) notnull default '' "` // 备注
+    MaxConcurrency int  `xorm:"smallint notnull default 0"`         // 最大并发任务数, 0不限制
     BaseModel       `xorm:"-"`
     Selected bool   `xorm:"-"`
 }
@@ -26,7 +27,7 @@ func (host *Host) Create() (insertId int16, err error) {
 }
 
 func (host *Host) UpdateBean(id int16) (int64, error)  {
-    return Db.ID(id).Cols("name,alias,port,remark").Update(host)
+    return Db.ID(id).Cols("name,alias,port,remark,max_concurrency").Update(host)
 }
 
 
@@ -73,6 +74,18 @@ func (host *Host) AllList() ([]Host, error) {
     return list, err
 }
 
+// 获取设置了最大并发数的主机, 主机ID作为Key
+func (host *Host) ConcurrencyLimits() (map[int16]int, error) {
+    list := make([]Host, 0)
+    err := Db.Where("max_concurrency > 0").Cols("id,max_concurrency").Find(&list)
+    limits := make(map[int16]int, len(list))
+    for _, value := range list {
+        limits[value.Id] = value.MaxConcurrency
+    }
+
+    return limits, err
+}
+
 func (host *Host) Total(params CommonMap) (int64, error) {
     session := Db.NewSession()
     host.parseWhere(session, params)
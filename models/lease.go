@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// 调度器主节点租约, 多个调度器实例通过抢占租约选出主节点, 只有主节点调度任务
+type Lease struct {
+	Name      string    `xorm:"varchar(32) pk notnull"`
+	Holder    string    `xorm:"varchar(128) notnull default ''"` // 租约持有者(调度器实例ID)
+	Token     int64     `xorm:"bigint notnull default 0"`        // fencing token, 每次易主加1, 续约及调度执行写入任务日志时校验
+	Revision  int64     `xorm:"bigint notnull default 0"`        // 任务配置版本号, 非主节点修改任务后加1, 主节点检测到变化后重新加载任务
+	ExpiredAt time.Time `xorm:"datetime"`                        // 租约过期时间, 以数据库时间为准
+}
+
+const LeaseScheduler = "scheduler"
+
+func leaseTableName() string {
+	return TablePrefix + "lease"
+}
+
+// 租约不存在时创建
+func (lease *Lease) Init(name string) error {
+	count, err := Db.Where("name = ?", name).Count(new(Lease))
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = Db.Insert(&Lease{Name: name})
+	if err == nil {
+		return nil
+	}
+	// 多个实例同时创建, 主键冲突
+	count, countErr := Db.Where("name = ?", name).Count(new(Lease))
+	if countErr == nil && count > 0 {
+		return nil
+	}
+
+	return err
+}
+
+func (lease *Lease) Get(name string) (Lease, error) {
+	l := Lease{}
+	exist, err := Db.Where("name = ?", name).Get(&l)
+	if err == nil && !exist {
+		err = fmt.Errorf("租约不存在-%s", name)
+	}
+
+	return l, err
+}
+
+// 抢占已过期的租约, 成功返回最新租约
+func (lease *Lease) Acquire(name, holder string, ttl int) (bool, Lease, error) {
+	sql := fmt.Sprintf("UPDATE %s SET holder = ?, token = token + 1, expired_at = DATE_ADD(NOW(), INTERVAL ? SECOND) "+
+		"WHERE name = ? AND (holder = '' OR expired_at IS NULL OR expired_at < NOW())", leaseTableName())
+	_, err := Db.Exec(sql, holder, ttl, name)
+	if err != nil {
+		return false, Lease{}, err
+	}
+	l, err := lease.Get(name)
+	if err != nil {
+		return false, l, err
+	}
+
+	return l.Holder == holder, l, nil
+}
+
+// 续约, 租约已被其他实例抢占时返回false
+func (lease *Lease) Renew(name, holder string, token int64, ttl int) (bool, Lease, error) {
+	sql := fmt.Sprintf("UPDATE %s SET expired_at = DATE_ADD(NOW(), INTERVAL ? SECOND) "+
+		"WHERE name = ? AND holder = ? AND token = ?", leaseTableName())
+	_, err := Db.Exec(sql, ttl, name, holder, token)
+	if err != nil {
+		return false, Lease{}, err
+	}
+	l, err := lease.Get(name)
+	if err != nil {
+		return false, l, err
+	}
+
+	return l.Holder == holder && l.Token == token, l, nil
+}
+
+// 主动释放租约
+func (lease *Lease) Release(name, holder string, token int64) error {
+	sql := fmt.Sprintf("UPDATE %s SET holder = '', expired_at = NULL WHERE name = ? AND holder = ? AND token = ?",
+		leaseTableName())
+	_, err := Db.Exec(sql, name, holder, token)
+
+	return err
+}
+
+// 租约仍由holder以token持有且未过期, 用于写入时校验fencing token
+func leaseHeldCondition() string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE name = ? AND holder = ? AND token = ? AND expired_at > NOW())",
+		leaseTableName())
+}
+
+// 任务配置版本号加1
+func (lease *Lease) IncrRevision(name string) error {
+	sql := fmt.Sprintf("UPDATE %s SET revision = revision + 1 WHERE name = ?", leaseTableName())
+	_, err := Db.Exec(sql, name)
+
+	return err
+}
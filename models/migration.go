@@ -6,6 +6,7 @@ import (
     "gocron/modules/logger"
     "github.com/go-xorm/xorm"
     "strconv"
+    "strings"
 )
 
 
@@ -19,7 +20,7 @@ func (migration *Migration) Install(dbName string) error {
     setting := new(Setting)
     task := new(Task)
     tables := []interface{}{
-        &User{}, task, &TaskLog{}, &Host{}, setting,&LoginLog{},&TaskHost{},
+        &User{}, task, &TaskLog{}, &Host{}, setting,&LoginLog{},&TaskHost{}, &Lease{}, &SchedulerInstance{}, &Calendar{}, &CalendarDate{}, &TaskLogAttempt{}, &TaskDependency{}, &WorkflowRun{}, &DelayedRun{}, &TaskCallback{},
     }
     for _, table := range tables {
         exist, err:= Db.IsTableExist(table)
@@ -54,10 +55,11 @@ func (migration *Migration) Upgrade(oldVersionId int)  {
         return
     }
 
-    versionIds   := []int{110, 122}
+    versionIds   := []int{110, 122, 130}
     upgradeFuncs := []func(*xorm.Session) error {
         migration.upgradeFor110,
         migration.upgradeFor122,
+        migration.upgradeFor130,
     }
 
     startIndex := -1
@@ -156,4 +158,197 @@ func (migration *Migration) upgradeFor122(session *xorm.Session) error {
     logger.Info("已升级到v1.2.2\n")
 
     return err
-}
\ No newline at end of file
+}
+
+// 升级到1.3.0版本
+func (migration *Migration) upgradeFor130(session *xorm.Session) error {
+    logger.Info("开始升级到v1.3.0")
+
+    taskTableName := TablePrefix + "task"
+    taskLogTableName := TablePrefix + "task_log"
+    sqls := []string{
+        // task表增加错过执行处理策略
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN misfire_policy TINYINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN misfire_limit SMALLINT NOT NULL DEFAULT 0", taskTableName),
+        // task表增加时区
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT ''", taskTableName),
+        // task_log表增加运行类型、计划执行时间
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN type TINYINT NOT NULL DEFAULT 1", taskLogTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN scheduled_time DATETIME NULL", taskLogTableName),
+        // task_log表增加调度器实例ID
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN instance VARCHAR(128) NOT NULL DEFAULT ''", taskLogTableName),
+        // task表增加引用的日历
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN calendar_ids VARCHAR(64) NOT NULL DEFAULT ''", taskTableName),
+        // task表增加启动延迟, task_log表记录实际延迟
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN jitter MEDIUMINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN jitter_mode TINYINT NOT NULL DEFAULT 1", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN delay INT NOT NULL DEFAULT 0", taskLogTableName),
+        // host表增加最大并发数, task_log表记录排队等待时长
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN max_concurrency SMALLINT NOT NULL DEFAULT 0", TablePrefix + "host"),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN wait_time INT NOT NULL DEFAULT 0", taskLogTableName),
+        // task表增加重叠执行策略, 0表示按multi字段处理
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN overlap_policy TINYINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN max_instances SMALLINT NOT NULL DEFAULT 0", taskTableName),
+        // task表增加重试间隔策略, 默认与旧版本一致, 第n次重试间隔n分钟
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN retry_policy TINYINT NOT NULL DEFAULT 2", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN retry_interval MEDIUMINT NOT NULL DEFAULT 60", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN retry_max_interval MEDIUMINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN retry_jitter TINYINT NOT NULL DEFAULT 0", taskTableName),
+        // task表增加需要重试的错误类型, 默认所有错误都重试
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN retry_on VARCHAR(32) NOT NULL DEFAULT '1,2,3,4,5,6'", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN retry_exit_codes VARCHAR(128) NOT NULL DEFAULT ''", taskTableName),
+        // task表增加子任务触发条件
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN trigger_rule TINYINT NOT NULL DEFAULT 1", taskTableName),
+        // task表增加任务参数
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN params VARCHAR(1024) NOT NULL DEFAULT ''", taskTableName),
+        // task表增加失败处理、成功处理任务
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN failure_hook_ids VARCHAR(64) NOT NULL DEFAULT ''", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN success_hook_ids VARCHAR(64) NOT NULL DEFAULT ''", taskTableName),
+        // task表增加调度方式、单次执行时间
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN schedule_type TINYINT NOT NULL DEFAULT 1", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN run_at DATETIME NULL", taskTableName),
+        // task表增加预期最长执行时间、每天最晚成功时间
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN sla_duration MEDIUMINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN sla_deadline VARCHAR(5) NOT NULL DEFAULT ''", taskTableName),
+        // task表增加HTTP请求配置
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_method VARCHAR(8) NOT NULL DEFAULT 'GET'", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_headers TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_query TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_body_type TINYINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_body TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_auth_type TINYINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_auth_user VARCHAR(128) NOT NULL DEFAULT ''", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_auth_secret VARCHAR(512) NOT NULL DEFAULT ''", taskTableName),
+        // task表增加HTTP响应断言
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_success_codes VARCHAR(128) NOT NULL DEFAULT ''", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_body_match_type TINYINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_body_match VARCHAR(512) NOT NULL DEFAULT ''", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_json_assertions TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_max_latency MEDIUMINT NOT NULL DEFAULT 0", taskTableName),
+        // task表增加异步执行、等待回调超时时间
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_async TINYINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN callback_timeout INT NOT NULL DEFAULT 3600", taskTableName),
+        // task表增加提交后轮询配置
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_job_id_path VARCHAR(256) NOT NULL DEFAULT ''", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_poll_url VARCHAR(1024) NOT NULL DEFAULT ''", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_poll_interval MEDIUMINT NOT NULL DEFAULT 10", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_poll_success TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_poll_failure TEXT NOT NULL", taskTableName),
+        // task表增加HTTP任务TLS、代理、重定向设置
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_ca_cert TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_client_cert TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_client_key TEXT NOT NULL", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_insecure_skip_verify TINYINT NOT NULL DEFAULT 0", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_proxy VARCHAR(256) NOT NULL DEFAULT ''", taskTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN http_redirect TINYINT NOT NULL DEFAULT 0", taskTableName),
+        // task_log表增加所属工作流运行记录
+        fmt.Sprintf("ALTER TABLE %s ADD COLUMN workflow_run_id BIGINT NOT NULL DEFAULT 0", taskLogTableName),
+        fmt.Sprintf("ALTER TABLE %s ADD INDEX IDX_%s_workflow_run_id (workflow_run_id)", taskLogTableName, taskLogTableName),
+    }
+    for _, sql := range sqls {
+        _, err := session.Exec(sql)
+        if err != nil {
+            return err
+        }
+    }
+
+    // 创建表lease, 用于调度器主备选举
+    err := session.Sync2(new(Lease))
+    if err != nil {
+        return err
+    }
+    // 创建表scheduler_instance, 记录运行中的调度器实例
+    err = session.Sync2(new(SchedulerInstance))
+    if err != nil {
+        return err
+    }
+    // 创建表calendar、calendar_date, 任务日历
+    err = session.Sync2(new(Calendar), new(CalendarDate))
+    if err != nil {
+        return err
+    }
+    // 创建表task_log_attempt, 记录每次重试
+    err = session.Sync2(new(TaskLogAttempt))
+    if err != nil {
+        return err
+    }
+    // 创建表task_dependency, 把task表中主任务配置的子任务写入依赖关系
+    err = migration.migrateTaskDependency(session, taskTableName)
+    if err != nil {
+        return err
+    }
+    // 创建表workflow_run, 记录工作流运行
+    err = session.Sync2(new(WorkflowRun))
+    if err != nil {
+        return err
+    }
+    // 创建表delayed_run, 记录延迟执行
+    err = session.Sync2(new(DelayedRun))
+    if err != nil {
+        return err
+    }
+    // 创建表task_callback, 记录异步HTTP任务回调
+    err = session.Sync2(new(TaskCallback))
+    if err != nil {
+        return err
+    }
+
+    logger.Info("已升级到v1.3.0\n")
+
+    return nil
+}
+
+func (migration *Migration) migrateTaskDependency(session *xorm.Session, taskTableName string) error {
+    err := session.Sync2(new(TaskDependency))
+    if err != nil {
+        return err
+    }
+    sql := fmt.Sprintf("SELECT id, dependency_task_id, dependency_status FROM %s WHERE dependency_task_id != ''", taskTableName)
+    results, err := session.Query(sql)
+    if err != nil {
+        return err
+    }
+    // 旧版本只执行子任务级别的依赖任务, 只迁移这部分依赖关系
+    childRows, err := session.Query(fmt.Sprintf("SELECT id FROM %s WHERE level = ?", taskTableName), TaskLevelChild)
+    if err != nil {
+        return err
+    }
+    childTaskIds := make(map[int]bool, len(childRows))
+    for _, value := range childRows {
+        taskId, err := strconv.Atoi(string(value["id"]))
+        if err != nil {
+            return err
+        }
+        childTaskIds[taskId] = true
+    }
+    for _, value := range results {
+        upstreamTaskId, err := strconv.Atoi(string(value["id"]))
+        if err != nil {
+            return err
+        }
+        status, err := strconv.Atoi(string(value["dependency_status"]))
+        if err != nil {
+            return err
+        }
+        for _, idStr := range strings.Split(string(value["dependency_task_id"]), ",") {
+            taskId, err := strconv.Atoi(strings.TrimSpace(idStr))
+            if err != nil || !childTaskIds[taskId] {
+                continue
+            }
+            dependencyModel := &TaskDependency{
+                TaskId: taskId,
+                UpstreamTaskId: upstreamTaskId,
+                Status: TaskDependencyStatus(status),
+            }
+            _, err = session.Insert(dependencyModel)
+            if err != nil {
+                return err
+            }
+        }
+    }
+
+    // 删除task表dependency_task_id、dependency_status字段
+    _, err = session.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN dependency_task_id, DROP COLUMN dependency_status", taskTableName))
+
+    return err
+}
@@ -21,13 +21,17 @@ var TablePrefix string = ""
 var Db *xorm.Engine
 
 const (
-	Disabled Status = 0 // 禁用
-	Failure  Status = 0 // 失败
-	Enabled  Status = 1 // 启用
-	Running  Status = 1 // 运行中
-	Finish   Status = 2 // 完成
-	Cancel   Status = 3 // 取消
-	Waiting  Status = 5 // 等待中
+	Disabled    Status = 0 // 禁用
+	Failure     Status = 0 // 失败
+	Enabled     Status = 1 // 启用
+	Running     Status = 1 // 运行中
+	Finish      Status = 2 // 完成
+	Cancel      Status = 3 // 取消
+	Async       Status = 4 // 异步执行, 等待回调
+	Waiting     Status = 5 // 等待中
+	Interrupted Status = 6 // 中断(应用退出时被强制结束)
+	Abandoned   Status = 7 // 异常中止(调度器异常退出, 执行结果未知)
+	Skipped     Status = 8 // 跳过(执行日期被日历排除)
 )
 
 const (
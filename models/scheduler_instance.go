@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// 运行中的调度器实例, 定时上报心跳, 用于判断任务日志所属实例是否存活
+type SchedulerInstance struct {
+	Id        string    `xorm:"varchar(128) pk notnull"` // 实例ID
+	Hostname  string    `xorm:"varchar(64) notnull default ''"`
+	Pid       int       `xorm:"int notnull default 0"`
+	Heartbeat time.Time `xorm:"datetime"`         // 最近一次心跳时间, 以数据库时间为准
+	Created   time.Time `xorm:"datetime created"` // 启动时间
+}
+
+func schedulerInstanceTableName() string {
+	return TablePrefix + "scheduler_instance"
+}
+
+// 注册实例
+func (instance *SchedulerInstance) Register() error {
+	_, err := Db.Insert(instance)
+	if err != nil {
+		return err
+	}
+
+	return instance.UpdateHeartbeat(instance.Id)
+}
+
+// 上报心跳
+func (instance *SchedulerInstance) UpdateHeartbeat(id string) error {
+	sql := fmt.Sprintf("UPDATE %s SET heartbeat = NOW() WHERE id = ?", schedulerInstanceTableName())
+	_, err := Db.Exec(sql, id)
+
+	return err
+}
+
+// 注销实例
+func (instance *SchedulerInstance) Unregister(id string) error {
+	_, err := Db.Where("id = ?", id).Delete(new(SchedulerInstance))
+
+	return err
+}
+
+// 获取ttl秒内有心跳的实例ID
+func (instance *SchedulerInstance) AliveIds(ttl int) ([]string, error) {
+	list := make([]SchedulerInstance, 0)
+	err := Db.Where("heartbeat >= DATE_SUB(NOW(), INTERVAL ? SECOND)", ttl).Cols("id").Find(&list)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(list))
+	for i, value := range list {
+		ids[i] = value.Id
+	}
+
+	return ids, nil
+}
+
+// 删除ttl秒内没有心跳的实例
+func (instance *SchedulerInstance) RemoveExpired(ttl int) (int64, error) {
+	return Db.Where("heartbeat IS NULL OR heartbeat < DATE_SUB(NOW(), INTERVAL ? SECOND)", ttl).
+		Delete(new(SchedulerInstance))
+}
@@ -2,6 +2,7 @@ package models
 
 import (
     "encoding/json"
+    "strconv"
 )
 
 type Setting struct  {
@@ -171,4 +172,94 @@ func (setting *Setting) RemoveMailUser(id int) (int64, error)  {
     setting.Id = id
     return Db.Delete(setting)
 }
-// endregion
\ No newline at end of file
+// endregion
+
+// region 并发数限制配置
+
+const ConcurrencyCode = "concurrency"
+const ConcurrencyGlobalKey = "global"
+const ConcurrencyTagKey = "tag"
+
+type Concurrency struct {
+    Global int // 全局最大并发数, 0不限制
+    Tags []TagConcurrency
+}
+
+type TagConcurrency struct {
+    Id int
+    Tag string
+    Limit int
+}
+
+func (setting *Setting) Concurrency() (Concurrency, error)  {
+    list := make([]Setting, 0)
+    err := Db.Where("code = ?", ConcurrencyCode).Find(&list)
+    concurrency := Concurrency{Tags: make([]TagConcurrency, 0)}
+    if err != nil {
+        return concurrency, err
+    }
+
+    for _, v := range list {
+        if v.Key == ConcurrencyGlobalKey {
+            concurrency.Global, _ = strconv.Atoi(v.Value)
+            continue
+        }
+        tagConcurrency := TagConcurrency{}
+        json.Unmarshal([]byte(v.Value), &tagConcurrency)
+        tagConcurrency.Id = v.Id
+        concurrency.Tags = append(concurrency.Tags, tagConcurrency)
+    }
+
+    return concurrency, err
+}
+
+// 更新全局最大并发数
+func (setting *Setting) UpdateConcurrencyGlobal(limit int) (int64, error)  {
+    where := Setting{Code: ConcurrencyCode, Key: ConcurrencyGlobalKey}
+    count, err := Db.Count(&where)
+    if err != nil {
+        return 0, err
+    }
+    setting.Code = ConcurrencyCode
+    setting.Key = ConcurrencyGlobalKey
+    setting.Value = strconv.Itoa(limit)
+    if count == 0 {
+        return Db.Insert(setting)
+    }
+
+    return Db.Cols("value").Update(setting, Setting{Code: ConcurrencyCode, Key: ConcurrencyGlobalKey})
+}
+
+func (setting *Setting) CreateTagConcurrency(tag string, limit int) (int64, error) {
+    setting.Code = ConcurrencyCode
+    setting.Key = ConcurrencyTagKey
+    jsonByte, err := json.Marshal(TagConcurrency{0, tag, limit})
+    if err != nil {
+        return 0, err
+    }
+    setting.Value = string(jsonByte)
+
+    return Db.Insert(setting)
+}
+
+func (setting *Setting) IsTagConcurrencyExist(tag string) (bool, error)  {
+    concurrency, err := setting.Concurrency()
+    if err != nil {
+        return false, err
+    }
+    for _, v := range concurrency.Tags {
+        if v.Tag == tag {
+            return true, nil
+        }
+    }
+
+    return false, nil
+}
+
+func (setting *Setting) RemoveTagConcurrency(id int) (int64, error)  {
+    setting.Code = ConcurrencyCode
+    setting.Key = ConcurrencyTagKey
+    setting.Id = id
+    return Db.Delete(setting)
+}
+// endregion
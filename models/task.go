@@ -5,6 +5,8 @@ import (
     "github.com/go-xorm/xorm"
     "errors"
     "strings"
+    "strconv"
+    "regexp"
 )
 
 type TaskProtocol int8
@@ -14,6 +16,49 @@ const (
     TaskRPC  // RPC方式执行命令
 )
 
+type TaskHttpBodyType int8
+
+const (
+    TaskHttpBodyNone TaskHttpBodyType = 0 // 无请求体
+    TaskHttpBodyForm TaskHttpBodyType = 1 // 表单, 每行一个, 格式为 参数名=值
+    TaskHttpBodyJSON TaskHttpBodyType = 2 // JSON
+)
+
+type TaskHttpAuthType int8
+
+const (
+    TaskHttpAuthNone   TaskHttpAuthType = 0 // 不认证
+    TaskHttpAuthBasic  TaskHttpAuthType = 1 // Basic认证
+    TaskHttpAuthBearer TaskHttpAuthType = 2 // Bearer Token
+)
+
+type TaskHttpMatchType int8
+
+const (
+    TaskHttpMatchNone     TaskHttpMatchType = 0 // 不检查响应内容
+    TaskHttpMatchContains TaskHttpMatchType = 1 // 响应内容包含指定字符串
+    TaskHttpMatchRegex    TaskHttpMatchType = 2 // 响应内容匹配正则表达式
+)
+
+type TaskHttpAsync int8
+
+const (
+    TaskHttpSync     TaskHttpAsync = 0 // 同步执行, 以请求响应作为执行结果
+    TaskHttpCallback TaskHttpAsync = 1 // 异步执行, 请求成功后等待远程服务回调
+    TaskHttpPoll     TaskHttpAsync = 2 // 提交后轮询, 从响应中获取任务ID后定时查询任务状态
+)
+
+type TaskHttpRedirect int8
+
+const (
+    TaskHttpRedirectFollow   TaskHttpRedirect = 0 // 跟随重定向
+    TaskHttpRedirectNone     TaskHttpRedirect = 1 // 不跟随重定向
+    TaskHttpRedirectSameHost TaskHttpRedirect = 2 // 只跟随同一主机的重定向
+)
+
+// HTTP任务支持的请求方法
+var TaskHttpMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH"}
+
 type TaskLevel int8
 
 const (
@@ -28,19 +73,126 @@ const (
     TaskDependencyStatusWeak   TaskDependencyStatus = 2 // 弱依赖
 )
 
+type TaskTriggerRule int8
+
+const (
+    TaskTriggerAllDone TaskTriggerRule = 1 // 所有上游任务完成且依赖均满足时执行
+    TaskTriggerAnyDone TaskTriggerRule = 2 // 任一上游任务依赖满足时执行
+)
+
+type TaskJitterMode int8
+
+const (
+    TaskJitterRandom        TaskJitterMode = 1 // 每次执行随机延迟
+    TaskJitterDeterministic TaskJitterMode = 2 // 按任务ID计算固定延迟
+)
+
+type TaskOverlapPolicy int8
+
+const (
+    TaskOverlapDefault  TaskOverlapPolicy = 0 // 按Multi字段, 允许多实例时不限制实例数, 否则跳过
+    TaskOverlapSkip     TaskOverlapPolicy = 1 // 跳过本次执行
+    TaskOverlapQueue    TaskOverlapPolicy = 2 // 等待正在执行的实例结束后执行, 最多一个等待中的执行
+    TaskOverlapReplace  TaskOverlapPolicy = 3 // 终止正在执行的实例, 重新执行
+    TaskOverlapParallel TaskOverlapPolicy = 4 // 允许多实例同时运行, 最多MaxInstances个
+)
+
+type TaskRetryPolicy int8
+
+const (
+    TaskRetryFixed       TaskRetryPolicy = 1 // 固定间隔
+    TaskRetryLinear      TaskRetryPolicy = 2 // 线性递增, 第n次重试间隔n倍
+    TaskRetryExponential TaskRetryPolicy = 3 // 指数递增, 第n次重试间隔2^(n-1)倍
+)
+
+type TaskErrorClass int8
+
+const (
+    TaskErrorUnavailable TaskErrorClass = 1 // 任务节点无法连接
+    TaskErrorTimeout     TaskErrorClass = 2 // 执行超时
+    TaskErrorHTTP5xx     TaskErrorClass = 3 // HTTP状态码5xx
+    TaskErrorHTTP4xx     TaskErrorClass = 4 // HTTP状态码4xx
+    TaskErrorExitCode    TaskErrorClass = 5 // 命令退出码非0
+    TaskErrorOther       TaskErrorClass = 6 // 其他错误
+)
+
+// 默认所有错误都重试, 与旧版本一致
+const TaskRetryOnAll = "1,2,3,4,5,6"
+
+type TaskScheduleType int8
+
+const (
+    TaskScheduleCrontab TaskScheduleType = 1 // 按crontab表达式周期执行
+    TaskScheduleOnce    TaskScheduleType = 2 // 指定时间执行一次, 执行后自动停止
+)
+
+type TaskMisfirePolicy int8
+
+const (
+    TaskMisfireIgnore  TaskMisfirePolicy = 0 // 忽略错过的执行
+    TaskMisfireRunOnce TaskMisfirePolicy = 1 // 补偿执行一次
+    TaskMisfireRunAll  TaskMisfirePolicy = 2 // 补偿执行所有错过的时间点
+)
+
 // 任务
 type Task struct {
     Id       int       `xorm:"int pk autoincr"`
     Name     string    `xorm:"varchar(32) notnull"`              // 任务名称
     Level    TaskLevel     `xorm:"smallint notnull index default 1"`     // 任务等级 1: 主任务 2: 依赖任务
-    DependencyTaskId string `xorm:"varchar(64) notnull default ''"` // 依赖任务ID,多个ID逗号分隔
-    DependencyStatus TaskDependencyStatus  `xorm:"smallint notnull default 1"`   // 依赖关系 1:强依赖 主任务执行成功, 依赖任务才会被执行 2:弱依赖
+    TriggerRule TaskTriggerRule `xorm:"tinyint notnull default 1"` // 子任务触发条件 1:所有上游任务完成 2:任一上游任务完成
+    ScheduleType TaskScheduleType `xorm:"tinyint notnull default 1"` // 调度方式 1:crontab 2:单次执行
     Spec     string    `xorm:"varchar(64) notnull"`              // crontab
+    RunAt    time.Time `xorm:"datetime"`                         // 单次执行时间
+    Timezone string    `xorm:"varchar(64) notnull default ''"`   // crontab时区, IANA时区名称, 为空使用服务器时区
+    CalendarIds string `xorm:"varchar(64) notnull default ''"`   // 引用的日历ID, 多个ID逗号分隔, 日历排除的日期不执行
+    FailureHookIds string `xorm:"varchar(64) notnull default ''"` // 执行失败(含超时、取消)后执行的任务ID, 多个逗号分隔
+    SuccessHookIds string `xorm:"varchar(64) notnull default ''"` // 执行成功后执行的任务ID, 多个逗号分隔
+    Jitter   int       `xorm:"mediumint notnull default 0"`      // 最大启动延迟(单位秒), 0不延迟
+    JitterMode TaskJitterMode `xorm:"tinyint notnull default 1"` // 延迟方式 1:随机 2:按任务固定
     Protocol TaskProtocol  `xorm:"tinyint notnull index"`              // 协议 1:http 2:系统命令
     Command  string    `xorm:"varchar(256) notnull"`             // URL地址或shell命令
+    Params   string    `xorm:"varchar(1024) notnull default ''"` // 任务参数, 每行一个, 格式为 参数名=默认值
+    HttpMethod string  `xorm:"varchar(8) notnull default 'GET'"` // HTTP请求方法
+    HttpHeaders string `xorm:"text notnull"`                     // HTTP请求头, 每行一个, 格式为 名称: 值
+    HttpQuery string   `xorm:"text notnull"`                     // HTTP查询参数, 每行一个, 格式为 参数名=值, 追加到URL中
+    HttpBodyType TaskHttpBodyType `xorm:"tinyint notnull default 0"` // HTTP请求体类型 0:无 1:表单 2:JSON
+    HttpBody string    `xorm:"text notnull"`                     // HTTP请求体
+    HttpAuthType TaskHttpAuthType `xorm:"tinyint notnull default 0"` // HTTP认证方式 0:不认证 1:Basic 2:Bearer
+    HttpAuthUser string `xorm:"varchar(128) notnull default ''"` // Basic认证用户名
+    HttpAuthSecret string `xorm:"varchar(512) notnull default ''"` // Basic认证密码或Bearer Token
+    HttpAsync TaskHttpAsync `xorm:"tinyint notnull default 0"`  // 执行方式 0:同步 1:异步回调 2:提交后轮询
+    CallbackTimeout int `xorm:"int notnull default 3600"`        // 等待回调超时时间(单位秒)
+    HttpJobIdPath string `xorm:"varchar(256) notnull default ''"` // 轮询模式, 从提交请求响应中获取任务ID的JSONPath
+    HttpPollUrl string `xorm:"varchar(1024) notnull default ''"`  // 轮询模式, 查询任务状态的URL, 可使用{{.Run.JobId}}
+    HttpPollInterval int `xorm:"mediumint notnull default 10"`  // 轮询模式, 轮询间隔(单位秒)
+    HttpPollSuccess string `xorm:"text notnull"`                 // 轮询模式, 成功条件, 每行一个, 格式为 JSONPath == 期望值, 全部满足时成功
+    HttpPollFailure string `xorm:"text notnull"`                 // 轮询模式, 失败条件, 每行一个, 格式为 JSONPath == 期望值, 任一满足时失败
+    HttpCaCert string `xorm:"text notnull"`                      // PEM格式CA证书, 为空时使用系统CA证书
+    HttpClientCert string `xorm:"text notnull"`                  // PEM格式客户端证书, 双向认证时使用
+    HttpClientKey string `xorm:"text notnull"`                   // PEM格式客户端私钥
+    HttpInsecureSkipVerify int8 `xorm:"tinyint notnull default 0"` // 是否跳过服务端证书校验 0:否 1:是
+    HttpProxy string `xorm:"varchar(256) notnull default ''"`    // 代理地址, 支持http、https、socks5
+    HttpRedirect TaskHttpRedirect `xorm:"tinyint notnull default 0"` // 重定向策略 0:跟随 1:不跟随 2:只跟随同一主机
+    HttpSuccessCodes string `xorm:"varchar(128) notnull default ''"` // 视为成功的HTTP状态码, 多个逗号分隔, 支持范围如200-299, 为空时只接受200
+    HttpBodyMatchType TaskHttpMatchType `xorm:"tinyint notnull default 0"` // 响应内容检查方式 0:不检查 1:包含字符串 2:正则表达式
+    HttpBodyMatch string `xorm:"varchar(512) notnull default ''"` // 响应内容需包含的字符串或匹配的正则表达式
+    HttpJsonAssertions string `xorm:"text notnull"`              // JSON响应断言, 每行一个, 格式为 JSONPath == 期望值
+    HttpMaxLatency int `xorm:"mediumint notnull default 0"`      // 最大响应时间(单位毫秒), 0不限制
     Timeout  int       `xorm:"mediumint notnull default 0"`      // 任务执行超时时间(单位秒),0不限制
+    SlaDuration int    `xorm:"mediumint notnull default 0"`      // 预期最长执行时间(单位秒), 超过后发送预警, 0不检查
+    SlaDeadline string `xorm:"varchar(5) notnull default ''"`    // 每天最晚成功时间, 格式HH:MM, 按任务时区, 为空不检查
     Multi    int8      `xorm:"tinyint notnull default 1"`        // 是否允许多实例运行
+    OverlapPolicy TaskOverlapPolicy `xorm:"tinyint notnull default 0"` // 上次执行未结束时的处理策略 1:跳过 2:排队 3:终止上次执行 4:多实例运行
+    MaxInstances int16 `xorm:"smallint notnull default 0"`       // 多实例运行时最大实例数, 0不限制
     RetryTimes int8    `xorm:"tinyint notnull default 0"`         // 重试次数
+    RetryPolicy TaskRetryPolicy `xorm:"tinyint notnull default 2"` // 重试间隔策略 1:固定 2:线性递增 3:指数递增
+    RetryInterval int  `xorm:"mediumint notnull default 60"`     // 重试间隔基数(单位秒)
+    RetryMaxInterval int `xorm:"mediumint notnull default 0"`   // 重试间隔上限(单位秒), 0不限制
+    RetryJitter int8   `xorm:"tinyint notnull default 0"`         // 重试间隔是否随机抖动 0:否 1:是
+    RetryOn string     `xorm:"varchar(32) notnull default '1,2,3,4,5,6'"` // 需要重试的错误类型, 多个逗号分隔
+    RetryExitCodes string `xorm:"varchar(128) notnull default ''"` // 需要重试的命令退出码, 多个逗号分隔, 为空时所有非0退出码都重试
+    MisfirePolicy TaskMisfirePolicy `xorm:"tinyint notnull default 0"` // 调度器停止期间错过执行的处理策略 0:忽略 1:补偿执行一次 2:补偿执行所有
+    MisfireLimit int16 `xorm:"smallint notnull default 0"`       // 补偿执行次数上限
     NotifyStatus int8  `xorm:"smallint notnull default 1"`       // 任务执行结束是否通知 0: 不通知 1: 失败通知 2: 执行结束通知
     NotifyType int8 `xorm:"smallint notnull default 0"`  // 通知类型 1: 邮件 2: slack
     NotifyReceiverId string `xorm:"varchar(256) notnull default '' "` // 通知接受者ID, setting表主键ID，多个ID逗号分隔
@@ -57,6 +209,173 @@ func taskHostTableName() []string {
     return []string{TablePrefix + "task_host", "th"}
 }
 
+// 上次执行未结束时的处理策略, 未设置时按Multi字段
+func (task Task) Overlap() TaskOverlapPolicy {
+    if task.OverlapPolicy != TaskOverlapDefault {
+        return task.OverlapPolicy
+    }
+    if task.Multi == 1 {
+        return TaskOverlapParallel
+    }
+
+    return TaskOverlapSkip
+}
+
+// 是否为单次执行任务
+func (task Task) IsOnce() bool {
+    return task.ScheduleType == TaskScheduleOnce
+}
+
+// 单次执行时间, 按任务时区格式化
+func (task Task) RunAtText() string {
+    if task.RunAt.IsZero() {
+        return ""
+    }
+    location := time.Local
+    if task.Timezone != "" {
+        taskLocation, err := time.LoadLocation(task.Timezone)
+        if err == nil {
+            location = taskLocation
+        }
+    }
+
+    return task.RunAt.In(location).Format(DefaultTimeFormat)
+}
+
+// 执行失败的错误类型是否需要重试
+func (task Task) RetryOnClass(class TaskErrorClass) bool {
+    for _, item := range strings.Split(task.RetryOn, ",") {
+        if strings.TrimSpace(item) == strconv.Itoa(int(class)) {
+            return true
+        }
+    }
+
+    return false
+}
+
+// 命令退出码是否需要重试
+func (task Task) RetryOnExitCode(code int) bool {
+    if !task.RetryOnClass(TaskErrorExitCode) {
+        return false
+    }
+    if strings.TrimSpace(task.RetryExitCodes) == "" {
+        return true
+    }
+    for _, item := range strings.Split(task.RetryExitCodes, ",") {
+        if strings.TrimSpace(item) == strconv.Itoa(code) {
+            return true
+        }
+    }
+
+    return false
+}
+
+var taskParamNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 解析任务参数, 忽略空行和#开头的行
+func (task Task) ParamMap() (map[string]string, error) {
+    params := make(map[string]string)
+    for _, line := range strings.Split(task.Params, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        pair := strings.SplitN(line, "=", 2)
+        name := strings.TrimSpace(pair[0])
+        if len(pair) != 2 || !taskParamNamePattern.MatchString(name) {
+            return params, errors.New("任务参数格式错误-" + line)
+        }
+        params[name] = strings.TrimSpace(pair[1])
+    }
+
+    return params, nil
+}
+
+// 键值对
+type TaskKeyValue struct {
+    Key   string
+    Value string
+}
+
+// 解析HTTP请求头, 格式为 名称: 值
+func (task Task) HttpHeaderList() ([]TaskKeyValue, error) {
+    return parseKeyValueLines(task.HttpHeaders, ":", httpHeaderNamePattern, "请求头")
+}
+
+// 解析HTTP查询参数, 格式为 参数名=值
+func (task Task) HttpQueryList() ([]TaskKeyValue, error) {
+    return parseKeyValueLines(task.HttpQuery, "=", httpFieldNamePattern, "查询参数")
+}
+
+// 解析HTTP表单请求体, 格式为 参数名=值
+func (task Task) HttpFormList() ([]TaskKeyValue, error) {
+    return parseKeyValueLines(task.HttpBody, "=", httpFieldNamePattern, "表单参数")
+}
+
+// 解析JSON响应断言, 格式为 JSONPath == 期望值
+func (task Task) HttpJsonAssertionList() ([]TaskKeyValue, error) {
+    return parseKeyValueLines(task.HttpJsonAssertions, "==", jsonPathPattern, "JSON断言")
+}
+
+// 解析轮询成功条件, 格式为 JSONPath == 期望值
+func (task Task) HttpPollSuccessList() ([]TaskKeyValue, error) {
+    return parseKeyValueLines(task.HttpPollSuccess, "==", jsonPathPattern, "成功条件")
+}
+
+// 解析轮询失败条件, 格式为 JSONPath == 期望值
+func (task Task) HttpPollFailureList() ([]TaskKeyValue, error) {
+    return parseKeyValueLines(task.HttpPollFailure, "==", jsonPathPattern, "失败条件")
+}
+
+// HTTP状态码是否视为成功
+func (task Task) AcceptHttpStatus(code int) bool {
+    if strings.TrimSpace(task.HttpSuccessCodes) == "" {
+        return code == 200
+    }
+    for _, item := range strings.Split(task.HttpSuccessCodes, ",") {
+        bounds := strings.SplitN(strings.TrimSpace(item), "-", 2)
+        min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+        if err != nil {
+            continue
+        }
+        max := min
+        if len(bounds) == 2 {
+            max, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+            if err != nil {
+                continue
+            }
+        }
+        if code >= min && code <= max {
+            return true
+        }
+    }
+
+    return false
+}
+
+var jsonPathPattern = regexp.MustCompile(`^\$\S*$`)
+var httpHeaderNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+var httpFieldNamePattern = regexp.MustCompile(`^[^\s=]+$`)
+
+// 解析每行一个的键值对, 忽略空行和#开头的行, 值为空时保留
+func parseKeyValueLines(text string, separator string, keyPattern *regexp.Regexp, name string) ([]TaskKeyValue, error) {
+    list := make([]TaskKeyValue, 0)
+    for _, line := range strings.Split(text, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        pair := strings.SplitN(line, separator, 2)
+        key := strings.TrimSpace(pair[0])
+        if len(pair) != 2 || !keyPattern.MatchString(key) {
+            return list, errors.New(name + "格式错误-" + line)
+        }
+        list = append(list, TaskKeyValue{Key: key, Value: strings.TrimSpace(pair[1])})
+    }
+
+    return list, nil
+}
+
 // 新增
 func (task *Task) Create() (insertId int, err error) {
     _, err = Db.Insert(task)
@@ -83,7 +402,7 @@ func (task *Task) CreateTestTask() {
 
 func (task *Task) UpdateBean(id int) (int64, error)  {
     return Db.ID(id).
-    Cols("name,spec,protocol,command,timeout,multi,retry_times,remark,notify_status,notify_type,notify_receiver_id, dependency_task_id, dependency_status, tag").
+    Cols("name,spec,protocol,command,timeout,multi,retry_times,remark,notify_status,notify_type,notify_receiver_id, trigger_rule, tag, misfire_policy, misfire_limit, timezone, calendar_ids, jitter, jitter_mode, overlap_policy, max_instances, retry_policy, retry_interval, retry_max_interval, retry_jitter, retry_on, retry_exit_codes, params, failure_hook_ids, success_hook_ids, schedule_type, run_at, sla_duration, sla_deadline, http_method, http_headers, http_query, http_body_type, http_body, http_auth_type, http_auth_user, http_auth_secret, http_success_codes, http_body_match_type, http_body_match, http_json_assertions, http_max_latency, http_async, callback_timeout, http_job_id_path, http_poll_url, http_poll_interval, http_poll_success, http_poll_failure, http_ca_cert, http_client_cert, http_client_key, http_insecure_skip_verify, http_proxy, http_redirect").
     Update(task)
 }
 
@@ -175,6 +494,14 @@ func (task *Task) GetStatus(id int) (Status, error) {
     return task.Status, nil
 }
 
+// 获取已保存的HTTP认证密码/Token和客户端私钥
+func (task *Task) HttpSecrets(id int) (authSecret string, clientKey string, err error) {
+    t := Task{}
+    _, err = Db.Id(id).Cols("http_auth_secret", "http_client_key").Get(&t)
+
+    return t.HttpAuthSecret, t.HttpClientKey, err
+}
+
 func(task *Task) Detail(id int) (Task, error)  {
     t := Task{}
     _, err := Db.Where("id=?", id).Get(&t)
@@ -203,31 +530,6 @@ func (task *Task) List(params CommonMap) ([]Task, error) {
     return task.setHostsForTasks(list)
 }
 
-// 获取依赖任务列表
-func (task *Task) GetDependencyTaskList(ids string) ([]Task, error) {
-    list := make([]Task, 0)
-    if ids == "" {
-        return list, nil
-    }
-    idList := strings.Split(ids, ",")
-    taskIds := make([]interface{}, len(idList))
-    for i,  v := range idList {
-        taskIds[i] = v
-    }
-    fields := "t.*"
-    err := Db.Alias("t").
-            Where("t.level = ?", TaskLevelChild).
-            In("t.id", taskIds).
-            Cols(fields).
-            Find(&list)
-
-    if err != nil {
-        return list, err
-    }
-
-    return task.setHostsForTasks(list)
-}
-
 func (task *Task) Total(params CommonMap) (int64, error) {
     session := Db.Alias("t").Join("LEFT", taskHostTableName(), "t.id = th.task_id")
     task.parseWhere(session, params)
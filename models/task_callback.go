@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+)
+
+// 异步HTTP任务回调, 每次执行(含重试)生成一个一次性回调地址
+type TaskCallback struct {
+	Id        int64     `xorm:"bigint pk autoincr"`
+	TaskLogId int64     `xorm:"bigint notnull index default 0"` // 任务日志id
+	Token     string    `xorm:"varchar(64) notnull"`            // 回调token的SHA256摘要
+	Status    Status    `xorm:"tinyint notnull default 1"`      // 状态 0:远程任务执行失败 1:等待回调 2:远程任务执行成功 3:已失效
+	Result    string    `xorm:"mediumtext notnull"`             // 回调提交的输出
+	ExpiredAt time.Time `xorm:"datetime notnull"`               // 过期时间
+	Created   time.Time `xorm:"datetime notnull created"`
+	Updated   time.Time `xorm:"datetime updated"`
+}
+
+func (callback *TaskCallback) Create() (insertId int64, err error) {
+	_, err = Db.Insert(callback)
+	if err == nil {
+		insertId = callback.Id
+	}
+
+	return
+}
+
+func (callback *TaskCallback) Detail(id int64) (TaskCallback, error) {
+	taskCallback := TaskCallback{}
+	_, err := Db.ID(id).Get(&taskCallback)
+
+	return taskCallback, err
+}
+
+// 提交回调结果, 只更新未过期且等待回调的记录, 回调地址只能使用一次
+func (callback *TaskCallback) Complete(id int64, token string, status Status, result string) (bool, error) {
+	affected, err := Db.Table(callback).
+		Where("id = ? AND token = ? AND status = ? AND expired_at > ?", id, token, Running, time.Now().Format(DefaultTimeFormat)).
+		Update(CommonMap{
+			"status": status,
+			"result": result,
+		})
+
+	return affected > 0, err
+}
+
+// 回调地址失效, 已回调返回false
+func (callback *TaskCallback) Expire(id int64) (bool, error) {
+	affected, err := Db.Table(callback).Where("id = ? AND status = ?", id, Running).Update(CommonMap{
+		"status": Cancel,
+	})
+
+	return affected > 0, err
+}
+
+// 清空表
+func (callback *TaskCallback) Clear() (int64, error) {
+	return Db.Where("1=1").Delete(callback)
+}
+
+// 删除指定时间前的记录
+func (callback *TaskCallback) RemoveBefore(t time.Time) (int64, error) {
+	return Db.Where("created <= ?", t.Format(DefaultTimeFormat)).Delete(callback)
+}
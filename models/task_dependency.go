@@ -0,0 +1,67 @@
+package models
+
+// 任务依赖关系, 上游任务执行完成后触发下游任务
+type TaskDependency struct {
+	Id             int                  `xorm:"int pk autoincr"`
+	TaskId         int                  `xorm:"int notnull index"`         // 下游任务ID
+	UpstreamTaskId int                  `xorm:"int notnull index"`         // 上游任务ID
+	Status         TaskDependencyStatus `xorm:"tinyint notnull default 1"` // 依赖关系 1:强依赖 上游任务执行成功才满足 2:弱依赖 上游任务执行完成即满足
+}
+
+// 保存任务的上游依赖, 覆盖原有依赖
+func (td *TaskDependency) Save(taskId int, dependencies []TaskDependency) error {
+	_, err := Db.Where("task_id = ?", taskId).Delete(new(TaskDependency))
+	if err != nil {
+		return err
+	}
+	if len(dependencies) == 0 {
+		return nil
+	}
+	for i := range dependencies {
+		dependencies[i].TaskId = taskId
+	}
+	_, err = Db.Insert(&dependencies)
+
+	return err
+}
+
+// 删除任务的所有上下游依赖
+func (td *TaskDependency) Remove(taskId int) error {
+	_, err := Db.Where("task_id = ? OR upstream_task_id = ?", taskId, taskId).Delete(new(TaskDependency))
+
+	return err
+}
+
+// 任务的上游依赖
+func (td *TaskDependency) ListByTaskId(taskId int) ([]TaskDependency, error) {
+	list := make([]TaskDependency, 0)
+	err := Db.Where("task_id = ?", taskId).Asc("id").Find(&list)
+
+	return list, err
+}
+
+// 任务的下游依赖
+func (td *TaskDependency) ListByUpstreamIds(upstreamTaskIds []int) ([]TaskDependency, error) {
+	list := make([]TaskDependency, 0)
+	if len(upstreamTaskIds) == 0 {
+		return list, nil
+	}
+	err := Db.In("upstream_task_id", upstreamTaskIds).Asc("id").Find(&list)
+
+	return list, err
+}
+
+// 所有依赖关系
+func (td *TaskDependency) AllList() ([]TaskDependency, error) {
+	list := make([]TaskDependency, 0)
+	err := Db.Asc("id").Find(&list)
+
+	return list, err
+}
+
+// 是否存在下游任务
+func (td *TaskDependency) HasDownstream(taskId int) (bool, error) {
+	count, err := Db.Where("upstream_task_id = ?", taskId).Count(td)
+
+	return count > 0, err
+}
@@ -1,12 +1,20 @@
 package models
 
 import (
+    "fmt"
     "time"
     "github.com/go-xorm/xorm"
 )
 
 type TaskType int8
 
+const (
+    TaskTypeNormal  TaskType = 1 // 正常调度
+    TaskTypeMisfire TaskType = 2 // 补偿执行
+    TaskTypeHook    TaskType = 3 // 失败或成功处理任务
+    TaskTypeBackfill TaskType = 4 // 回填执行
+    TaskTypeDelayed TaskType = 5 // 延迟执行
+)
 
 // 任务执行日志
 type TaskLog struct {
@@ -19,11 +27,18 @@ type TaskLog struct {
     Timeout  int       `xorm:"mediumint notnull default 0"`       // 任务执行超时时间(单位秒),0不限制
     RetryTimes int8    `xorm:"tinyint notnull default 0"`           // 任务重试次数
     Hostname string       `xorm:"varchar(128) notnull defalut '' "`   // RPC主机名，逗号分隔
+    Type      TaskType  `xorm:"tinyint notnull default 1"`          // 运行类型 1:正常调度 2:补偿执行 3:失败或成功处理 4:回填执行 5:延迟执行
+    ScheduledTime time.Time `xorm:"datetime"`                       // 计划执行时间
+    Delay     int       `xorm:"int notnull default 0"`               // 启动延迟(单位毫秒)
+    WaitTime  int       `xorm:"int notnull default 0"`               // 超过并发数限制排队等待时长(单位秒)
+    Instance  string    `xorm:"varchar(128) notnull default ''"`   // 创建日志的调度器实例ID
+    WorkflowRunId int64 `xorm:"bigint notnull index default 0"`     // 所属工作流运行记录id, 0表示不属于工作流
     StartTime time.Time `xorm:"datetime created"`                   // 开始执行时间
     EndTime   time.Time `xorm:"datetime updated"`                   // 执行完成（失败）时间
-    Status    Status    `xorm:"tinyint notnull index default 1"`          // 状态 0:执行失败 1:执行中  2:执行完毕 3:任务取消(上次任务未执行完成) 4:异步执行
+    Status    Status    `xorm:"tinyint notnull index default 1"`          // 状态 0:执行失败 1:执行中  2:执行完毕 3:任务取消(上次任务未执行完成、被新的执行终止或主节点租约失效) 4:异步执行 5:排队中 6:中断 7:异常中止 8:跳过
     Result    string    `xorm:"mediumtext notnull defalut '' "` // 执行结果
     TotalTime int       `xorm:"-"` // 执行总时长
+    QueuePosition int   `xorm:"-"` // 排队位置, 0未知
     BaseModel   `xorm:"-"`
 }
 
@@ -36,6 +51,38 @@ func (taskLog *TaskLog) Create() (insertId int64, err error) {
     return
 }
 
+// 租约仍有效时写入日志, 租约已被其他实例抢占或已过期时held为false
+// 读取租约时加共享锁, 写入完成前其他实例无法抢占租约
+func (taskLog *TaskLog) CreateWithLease(name, holder string, token int64) (insertId int64, held bool, err error) {
+    session := Db.NewSession()
+    defer session.Close()
+    err = session.Begin()
+    if err != nil {
+        return 0, false, err
+    }
+    rows, err := session.Query(fmt.Sprintf("SELECT token FROM %s WHERE name = ? AND holder = ? AND token = ? AND expired_at > NOW() LOCK IN SHARE MODE",
+        leaseTableName()), name, holder, token)
+    if err != nil {
+        session.Rollback()
+        return 0, false, err
+    }
+    if len(rows) == 0 {
+        session.Rollback()
+        return 0, false, nil
+    }
+    _, err = session.Insert(taskLog)
+    if err != nil {
+        session.Rollback()
+        return 0, false, err
+    }
+    err = session.Commit()
+    if err != nil {
+        return 0, false, err
+    }
+
+    return taskLog.Id, true, nil
+}
+
 // 更新
 func (taskLog *TaskLog) Update(id int64, data CommonMap) (int64, error) {
     return Db.Table(taskLog).ID(id).Update(data)
@@ -50,9 +97,13 @@ func (taskLog *TaskLog) List(params CommonMap) ([]TaskLog, error) {
     if len(list) > 0 {
         for i, item := range list {
             endTime := item.EndTime
-            if item.Status == Running {
+            if item.Status == Running || item.Status == Async {
                 endTime = time.Now()
             }
+            if item.Status == Waiting {
+                list[i].WaitTime = int(time.Now().Sub(item.StartTime).Seconds())
+                continue
+            }
             execSeconds := endTime.Sub(item.StartTime).Seconds()
             list[i].TotalTime = int(execSeconds)
         }
@@ -61,14 +112,141 @@ func (taskLog *TaskLog) List(params CommonMap) ([]TaskLog, error) {
     return list, err
 }
 
+// 获取工作流运行记录的所有任务日志
+func (taskLog *TaskLog) ListByWorkflowRunId(workflowRunId int64) ([]TaskLog, error) {
+    list := make([]TaskLog, 0)
+    err := Db.Where("workflow_run_id = ?", workflowRunId).Asc("id").Omit("result").Find(&list)
+    for i, item := range list {
+        endTime := item.EndTime
+        if item.Status == Running || item.Status == Waiting || item.Status == Async {
+            endTime = time.Now()
+        }
+        list[i].TotalTime = int(endTime.Sub(item.StartTime).Seconds())
+    }
+
+    return list, err
+}
+
+// 异步执行, 等待回调
+func (taskLog *TaskLog) StartAsync(id int64) (int64, error) {
+    return taskLog.Update(id, CommonMap{"status": Async})
+}
+
+// 排队结束, 开始执行
+func (taskLog *TaskLog) StartWaiting(id int64, waitTime int) (int64, error) {
+    return taskLog.Update(id, CommonMap{
+        "status": Running,
+        "start_time": time.Now(),
+        "wait_time": waitTime,
+    })
+}
+
+// 租约仍有效时排队结束开始执行, 租约已失效时返回false
+func (taskLog *TaskLog) StartWaitingWithLease(id int64, waitTime int, name, holder string, token int64) (bool, error) {
+    affected, err := Db.Table(taskLog).Where("id = ?", id).And(leaseHeldCondition(), name, holder, token).Update(CommonMap{
+        "status": Running,
+        "start_time": time.Now(),
+        "wait_time": waitTime,
+    })
+
+    return affected > 0, err
+}
+
+// 获取任务最近一次开始执行时间, 无执行记录返回零值
+func (taskLog *TaskLog) LastStartTime(taskId int) (time.Time, error) {
+    log := new(TaskLog)
+    exist, err := Db.Where("task_id = ?", taskId).Desc("id").Cols("start_time").Get(log)
+    if err != nil || !exist {
+        return time.Time{}, err
+    }
+
+    return log.StartTime, nil
+}
+
+// 任务在时间范围内是否执行成功过
+func (taskLog *TaskLog) SucceededBetween(taskId int, start, end time.Time) (bool, error) {
+    count, err := Db.Where("task_id = ? AND status = ? AND end_time >= ? AND end_time <= ?",
+        taskId, Finish, start.Local().Format(DefaultTimeFormat), end.Local().Format(DefaultTimeFormat)).Count(new(TaskLog))
+
+    return count > 0, err
+}
+
+// 任务正在执行的日志ID
+func (taskLog *TaskLog) RunningIds(taskId int) ([]int64, error) {
+    list := make([]TaskLog, 0)
+    err := Db.Where("task_id = ?", taskId).In("status", Running, Async).Cols("id").Find(&list)
+    ids := make([]int64, len(list))
+    for i, item := range list {
+        ids[i] = item.Id
+    }
+
+    return ids, err
+}
+
+// 获取已退出的调度器实例遗留的执行中、排队中日志
+func (taskLog *TaskLog) OrphanList(aliveInstances []string) ([]TaskLog, error) {
+    list := make([]TaskLog, 0)
+    session := Db.In("status", Running, Waiting, Async)
+    if len(aliveInstances) > 0 {
+        instances := make([]interface{}, len(aliveInstances))
+        for i, value := range aliveInstances {
+            instances[i] = value
+        }
+        session.NotIn("instance", instances...)
+    }
+    err := session.Cols("id,task_id,name,instance,start_time").Find(&list)
+
+    return list, err
+}
+
+// 标记日志为异常中止, 日志状态已变更返回false
+func (taskLog *TaskLog) Abandon(id int64, result string) (bool, error) {
+    affected, err := Db.Table(taskLog).Where("id = ?", id).In("status", Running, Waiting, Async).Update(CommonMap{
+        "status": Abandoned,
+        "result": result,
+    })
+
+    return affected > 0, err
+}
+
 // 清空表
 func (taskLog *TaskLog) Clear() (int64, error)  {
+    attemptModel := new(TaskLogAttempt)
+    _, err := attemptModel.Clear()
+    if err != nil {
+        return 0, err
+    }
+    workflowRunModel := new(WorkflowRun)
+    _, err = workflowRunModel.Clear()
+    if err != nil {
+        return 0, err
+    }
+    callbackModel := new(TaskCallback)
+    _, err = callbackModel.Clear()
+    if err != nil {
+        return 0, err
+    }
     return Db.Where("1=1").Delete(taskLog);
 }
 
 // 删除N个月前的日志
 func (taskLog *TaskLog) Remove(id int) (int64, error) {
     t := time.Now().AddDate(0, -id, 0)
+    attemptModel := new(TaskLogAttempt)
+    _, err := attemptModel.RemoveBefore(t)
+    if err != nil {
+        return 0, err
+    }
+    workflowRunModel := new(WorkflowRun)
+    _, err = workflowRunModel.RemoveBefore(t)
+    if err != nil {
+        return 0, err
+    }
+    callbackModel := new(TaskCallback)
+    _, err = callbackModel.RemoveBefore(t)
+    if err != nil {
+        return 0, err
+    }
     return Db.Where("start_time <= ?", t.Format(DefaultTimeFormat)).Delete(taskLog)
 }
 
@@ -96,4 +274,8 @@ func (taskLog *TaskLog) parseWhere(session *xorm.Session, params CommonMap)  {
     if ok && status.(int) > -1 {
         session.And("status = ?", status)
     }
+    workflowRunId, ok := params["WorkflowRunId"]
+    if ok && workflowRunId.(int64) > 0 {
+        session.And("workflow_run_id = ?", workflowRunId)
+    }
 }
\ No newline at end of file
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// 任务每次执行(含重试)的记录
+type TaskLogAttempt struct {
+	Id        int64     `xorm:"bigint pk autoincr"`
+	TaskLogId int64     `xorm:"bigint notnull index default 0"` // 任务日志id
+	Attempt   int16     `xorm:"smallint notnull default 1"`     // 第几次执行, 从1开始
+	Status    Status    `xorm:"tinyint notnull default 0"`      // 状态 0:失败 2:成功 3:被新的执行终止 6:中断
+	Output    string    `xorm:"mediumtext notnull"`             // 输出
+	Error     string    `xorm:"varchar(1024) notnull default ''"`
+	StartTime time.Time `xorm:"datetime"`
+	EndTime   time.Time `xorm:"datetime"`
+}
+
+func (attempt *TaskLogAttempt) Create() (insertId int64, err error) {
+	_, err = Db.Insert(attempt)
+	if err == nil {
+		insertId = attempt.Id
+	}
+
+	return
+}
+
+// 获取任务日志的所有执行记录
+func (attempt *TaskLogAttempt) List(taskLogId int64) ([]TaskLogAttempt, error) {
+	list := make([]TaskLogAttempt, 0)
+	err := Db.Where("task_log_id = ?", taskLogId).Asc("attempt").Find(&list)
+
+	return list, err
+}
+
+// 清空表
+func (attempt *TaskLogAttempt) Clear() (int64, error) {
+	return Db.Where("1=1").Delete(attempt)
+}
+
+// 删除指定时间前的记录
+func (attempt *TaskLogAttempt) RemoveBefore(t time.Time) (int64, error) {
+	return Db.Where("start_time <= ?", t.Format(DefaultTimeFormat)).Delete(attempt)
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+// 工作流运行记录, 根任务的一次执行及其触发的所有下游任务
+type WorkflowRun struct {
+	Id           int64     `xorm:"bigint pk autoincr"`
+	TaskId       int       `xorm:"int notnull index default 0"`     // 根任务id
+	Name         string    `xorm:"varchar(32) notnull"`             // 根任务名称
+	Dependencies string    `xorm:"text notnull"`                    // 本次运行涉及的依赖关系(JSON)
+	Instance     string    `xorm:"varchar(128) notnull default ''"` // 创建记录的调度器实例ID
+	StartTime    time.Time `xorm:"datetime created"`
+	EndTime      time.Time `xorm:"datetime"`
+	Status       Status    `xorm:"tinyint notnull index default 1"` // 状态 0:失败(存在失败或跳过的任务) 1:执行中 2:执行完毕 3:取消(根任务未执行、被新的执行终止或主节点租约失效) 6:中断 7:异常中止
+	TotalTime    int       `xorm:"-"`                               // 执行总时长
+	BaseModel    `xorm:"-"`
+}
+
+func (run *WorkflowRun) Create() (insertId int64, err error) {
+	_, err = Db.Insert(run)
+	if err == nil {
+		insertId = run.Id
+	}
+
+	return
+}
+
+// 运行结束, 只更新执行中的记录
+func (run *WorkflowRun) Finish(id int64, status Status) (int64, error) {
+	return Db.Table(run).Where("id = ? AND status = ?", id, Running).Update(CommonMap{
+		"status":   status,
+		"end_time": time.Now(),
+	})
+}
+
+func (run *WorkflowRun) Detail(id int64) (WorkflowRun, error) {
+	workflowRun := WorkflowRun{}
+	_, err := Db.ID(id).Get(&workflowRun)
+	if err != nil || workflowRun.Id <= 0 {
+		return workflowRun, err
+	}
+	workflowRun.TotalTime = workflowRun.totalTime()
+
+	return workflowRun, nil
+}
+
+func (run *WorkflowRun) List(params CommonMap) ([]WorkflowRun, error) {
+	run.parsePageAndPageSize(params)
+	list := make([]WorkflowRun, 0)
+	session := Db.Desc("id")
+	run.parseWhere(session, params)
+	err := session.Omit("dependencies").Limit(run.PageSize, run.pageLimitOffset()).Find(&list)
+	for i := range list {
+		list[i].TotalTime = list[i].totalTime()
+	}
+
+	return list, err
+}
+
+func (run *WorkflowRun) Total(params CommonMap) (int64, error) {
+	session := Db.NewSession()
+	defer session.Close()
+	run.parseWhere(session, params)
+
+	return session.Count(run)
+}
+
+func (run WorkflowRun) totalTime() int {
+	endTime := run.EndTime
+	if run.Status == Running {
+		endTime = time.Now()
+	}
+
+	return int(endTime.Sub(run.StartTime).Seconds())
+}
+
+// 获取已退出的调度器实例遗留的执行中记录
+func (run *WorkflowRun) OrphanList(aliveInstances []string) ([]WorkflowRun, error) {
+	list := make([]WorkflowRun, 0)
+	session := Db.Where("status = ?", Running)
+	if len(aliveInstances) > 0 {
+		instances := make([]interface{}, len(aliveInstances))
+		for i, value := range aliveInstances {
+			instances[i] = value
+		}
+		session.NotIn("instance", instances...)
+	}
+	err := session.Cols("id,task_id,name,instance,start_time").Find(&list)
+
+	return list, err
+}
+
+// 清空表
+func (run *WorkflowRun) Clear() (int64, error) {
+	return Db.Where("1=1").Delete(run)
+}
+
+// 删除指定时间前的记录
+func (run *WorkflowRun) RemoveBefore(t time.Time) (int64, error) {
+	return Db.Where("start_time <= ?", t.Format(DefaultTimeFormat)).Delete(run)
+}
+
+// 解析where
+func (run *WorkflowRun) parseWhere(session *xorm.Session, params CommonMap) {
+	if len(params) == 0 {
+		return
+	}
+	taskId, ok := params["TaskId"]
+	if ok && taskId.(int) > 0 {
+		session.And("task_id = ?", taskId)
+	}
+	status, ok := params["Status"]
+	if ok && status.(int) > -1 {
+		session.And("status = ?", status)
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"os"
 
 	"io/ioutil"
@@ -24,6 +25,7 @@ var (
 	Setting         *setting.Setting // 应用配置
 	VersionId       int              // 版本号
 	VersionFile     string           // 版本号文件
+	InstanceId      string           // 当前实例ID, 主机名-进程ID-随机字符串
 )
 
 func InitEnv(versionString, cfgType, cfgPrefix string) {
@@ -43,6 +45,17 @@ func InitEnv(versionString, cfgType, cfgPrefix string) {
 	checkDirExists(ConfDir, LogDir, DataDir)
 	Installed = IsInstalled()
 	VersionId = ToNumberVersion(versionString)
+	InstanceId = newInstanceId()
+}
+
+// 生成实例ID, 用于区分同时运行的多个调度器实例
+func newInstanceId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), utils.RandString(6))
 }
 
 // 判断应用是否已安装
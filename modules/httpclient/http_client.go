@@ -8,12 +8,55 @@ import (
     "time"
     "fmt"
     "bytes"
+    "net"
+    "golang.org/x/net/context"
 )
 
 type ResponseWrapper struct  {
     StatusCode int
     Body string
     Header http.Header
+    Timeout bool // 请求超时
+}
+
+// 自定义HTTP请求
+type Request struct {
+    Method string
+    Url string
+    Header http.Header
+    Body string
+    Timeout int // 超时时间(单位秒), 0不限制
+    Options Options // TLS、代理、重定向设置
+}
+
+// 发送自定义请求, ctx取消时中止请求
+func Do(ctx context.Context, r Request) ResponseWrapper {
+    var body *bytes.Buffer = bytes.NewBufferString(r.Body)
+    req, err := http.NewRequest(r.Method, r.Url, body)
+    if err != nil {
+        return createRequestError(err)
+    }
+    for key, values := range r.Header {
+        for _, value := range values {
+            req.Header.Add(key, value)
+        }
+    }
+    if ctx != nil {
+        req = req.WithContext(ctx)
+    }
+    transport, err := newTransport(r.Options)
+    if err != nil {
+        return createRequestError(err)
+    }
+    client := newClient(r.Timeout)
+    client.CheckRedirect = checkRedirect(r.Options.Redirect)
+    if transport != nil {
+        // 每次请求使用单独的连接, 请求结束后关闭
+        client.Transport = transport
+        defer transport.CloseIdleConnections()
+    }
+
+    return send(req, client)
 }
 
 func Get(url string, timeout int) ResponseWrapper {
@@ -48,15 +91,27 @@ func PostJson(url string, body string, timeout int) ResponseWrapper {
 }
 
 func request(req *http.Request, timeout int) ResponseWrapper {
-    wrapper := ResponseWrapper{StatusCode: 0, Body: "", Header: make(http.Header)}
+    return send(req, newClient(timeout))
+}
+
+func newClient(timeout int) *http.Client {
     client := &http.Client{}
     if timeout > 0 {
         client.Timeout = time.Duration(timeout) * time.Second
     }
+
+    return client
+}
+
+func send(req *http.Request, client *http.Client) ResponseWrapper {
+    wrapper := ResponseWrapper{StatusCode: 0, Body: "", Header: make(http.Header)}
     setRequestHeader(req)
     resp, err := client.Do(req)
     if err != nil {
         wrapper.Body = fmt.Sprintf("执行HTTP请求错误-%s", err.Error())
+        if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+            wrapper.Timeout = true
+        }
         return wrapper
     }
     defer resp.Body.Close()
@@ -72,12 +127,17 @@ func request(req *http.Request, timeout int) ResponseWrapper {
     return wrapper
 }
 
+// 设置默认请求头, 不覆盖已设置的请求头
 func setRequestHeader(req *http.Request)  {
-    req.Header.Set("Accept-Language", "zh-CN,zh;q=0.8,en;q=0.6")
-    req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/57.0.2987.133 Safari/537.36 golang/gocron")
+    if req.Header.Get("Accept-Language") == "" {
+        req.Header.Set("Accept-Language", "zh-CN,zh;q=0.8,en;q=0.6")
+    }
+    if req.Header.Get("User-Agent") == "" {
+        req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/57.0.2987.133 Safari/537.36 golang/gocron")
+    }
 }
 
 func createRequestError(err error) ResponseWrapper {
     errorMessage := fmt.Sprintf("创建HTTP请求错误-%s", err.Error())
-    return ResponseWrapper{0, errorMessage, make(http.Header)}
+    return ResponseWrapper{0, errorMessage, make(http.Header), false}
 }
\ No newline at end of file
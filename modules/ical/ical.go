@@ -0,0 +1,177 @@
+package ical
+
+// 解析iCal(.ics)文件中的事件, 用于导入节假日日历
+// 只解析事件的名称和起止日期, 不支持重复规则(RRULE), 重复事件只取第一次
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405"
+)
+
+// 事件, 起止日期均包含当天
+type Event struct {
+	Summary   string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// 解析iCal内容
+func Parse(content string) ([]Event, error) {
+	lines := unfold(content)
+	events := make([]Event, 0)
+	isCalendar := false
+	var event map[string]property
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行格式错误: %s", i+1, line)
+		}
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VCALENDAR"):
+			isCalendar = true
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			event = make(map[string]property)
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			if event == nil {
+				return nil, fmt.Errorf("第%d行缺少BEGIN:VEVENT", i+1)
+			}
+			e, err := newEvent(event)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+			event = nil
+		case event != nil:
+			// 同名属性只取第一个
+			if _, ok := event[prop.name]; !ok {
+				event[prop.name] = prop
+			}
+		}
+	}
+	if !isCalendar {
+		return nil, errors.New("不是有效的iCal文件, 缺少BEGIN:VCALENDAR")
+	}
+
+	return events, nil
+}
+
+// 展开折行, 以空格或制表符开头的行是上一行的延续
+func unfold(content string) []string {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// 解析属性行 NAME;PARAM=VALUE:VALUE
+func parseProperty(line string) (property, error) {
+	prop := property{params: make(map[string]string)}
+	inQuote := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuote = !inQuote
+		}
+		if c == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return prop, errors.New("missing colon")
+	}
+	prop.value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(strings.TrimSpace(parts[0]))
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		prop.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+
+	return prop, nil
+}
+
+func newEvent(props map[string]property) (Event, error) {
+	event := Event{Summary: unescape(props["SUMMARY"].value)}
+	start, ok := props["DTSTART"]
+	if !ok {
+		return event, fmt.Errorf("事件[%s]缺少DTSTART", event.Summary)
+	}
+	startTime, startIsDate, err := parseDate(start)
+	if err != nil {
+		return event, fmt.Errorf("事件[%s]DTSTART格式错误: %s", event.Summary, start.value)
+	}
+	event.StartDate = truncateDate(startTime)
+	event.EndDate = event.StartDate
+
+	end, ok := props["DTEND"]
+	if !ok {
+		return event, nil
+	}
+	endTime, endIsDate, err := parseDate(end)
+	if err != nil {
+		return event, fmt.Errorf("事件[%s]DTEND格式错误: %s", event.Summary, end.value)
+	}
+	endDate := truncateDate(endTime)
+	// 全天事件的结束日期不包含在内; 结束于零点的事件不包含结束当天
+	if endIsDate || (!startIsDate && endTime.Equal(endDate)) {
+		endDate = endDate.AddDate(0, 0, -1)
+	}
+	if endDate.After(event.StartDate) {
+		event.EndDate = endDate
+	}
+
+	return event, nil
+}
+
+// 解析日期或日期时间, 日期时间按书写的本地时间取日期, 不做时区转换
+func parseDate(prop property) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.value)
+	if strings.EqualFold(prop.params["VALUE"], "DATE") || len(value) == len(dateFormat) {
+		t, err := time.Parse(dateFormat, value)
+		return t, true, err
+	}
+	t, err := time.Parse(dateTimeFormat, strings.TrimSuffix(value, "Z"))
+
+	return t, false, err
+}
+
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// 还原转义字符
+func unescape(value string) string {
+	replacer := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+	return strings.TrimSpace(replacer.Replace(value))
+}
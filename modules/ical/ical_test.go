@@ -0,0 +1,65 @@
+package ical
+
+import "testing"
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//test//CN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20241001\r\n" +
+	"DTEND;VALUE=DATE:20241008\r\n" +
+	"SUMMARY:国庆\r\n" +
+	" 节\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20250101\r\n" +
+	"SUMMARY:元旦\\, 放假\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;TZID=\"Asia/Shanghai\":20241231T090000\r\n" +
+	"DTEND;TZID=\"Asia/Shanghai\":20250102T000000\r\n" +
+	"SUMMARY:封版\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(testCalendar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		summary string
+		start   string
+		end     string
+	}{
+		{"国庆节", "2024-10-01", "2024-10-07"},
+		{"元旦, 放假", "2025-01-01", "2025-01-01"},
+		{"封版", "2024-12-31", "2025-01-01"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("事件数量不匹配, 期望%d, 实际%d", len(expected), len(events))
+	}
+	for i, e := range expected {
+		event := events[i]
+		start := event.StartDate.Format("2006-01-02")
+		end := event.EndDate.Format("2006-01-02")
+		if event.Summary != e.summary || start != e.start || end != e.end {
+			t.Errorf("事件解析错误, 期望%s %s~%s, 实际%s %s~%s",
+				e.summary, e.start, e.end, event.Summary, start, end)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	invalids := []string{
+		"",
+		"BEGIN:VEVENT\nDTSTART:20240101\nEND:VEVENT\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:x\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:2024-01-01\nEND:VEVENT\nEND:VCALENDAR\n",
+	}
+	for _, content := range invalids {
+		if _, err := Parse(content); err == nil {
+			t.Errorf("期望解析失败-%q", content)
+		}
+	}
+}
@@ -14,24 +14,41 @@ import (
 
 var (
     errUnavailable = errors.New("无法连接远程服务器")
+    errCanceled    = errors.New("任务被取消, 强制结束")
+    errTimeout     = errors.New("执行超时, 强制结束")
 )
 
-func ExecWithRetry(ip string, port int, taskReq *pb.TaskRequest) (string, error)  {
+// 是否因无法连接任务节点失败
+func IsUnavailable(err error) bool {
+    return err == errUnavailable
+}
+
+// 是否因执行超时失败
+func IsTimeout(err error) bool {
+    return err == errTimeout
+}
+
+func ExecWithRetry(ctx context.Context, ip string, port int, taskReq *pb.TaskRequest) (string, error)  {
     tryTimes := 60
     i := 0
     for i < tryTimes {
-        output, err := Exec(ip, port, taskReq)
+        output, err := Exec(ctx, ip, port, taskReq)
         if err != errUnavailable {
             return output, err
         }
         i++
-        time.Sleep(2 * time.Second)
+        select {
+        case <-time.After(2 * time.Second):
+        case <-ctx.Done():
+            return "", errCanceled
+        }
     }
 
     return "", errUnavailable
 }
 
-func Exec(ip string, port int, taskReq *pb.TaskRequest) (string, error)  {
+// 执行命令, ctx取消时节点上的命令被强制结束
+func Exec(ctx context.Context, ip string, port int, taskReq *pb.TaskRequest) (string, error)  {
     defer func() {
        if err := recover(); err != nil {
            logger.Error("panic#rpc/client.go:Exec#", err)
@@ -53,7 +70,7 @@ func Exec(ip string, port int, taskReq *pb.TaskRequest) (string, error)  {
         taskReq.Timeout = 86400
     }
     timeout := time.Duration(taskReq.Timeout) * time.Second
-    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    ctx, cancel := context.WithTimeout(ctx, timeout)
     defer cancel()
     resp, err := c.Run(ctx, taskReq)
     if err != nil {
@@ -74,7 +91,9 @@ func parseGRPCError(err error, conn *grpc.ClientConn, connClosed *bool) (string,
             *connClosed = true
             return "", errUnavailable
         case codes.DeadlineExceeded:
-            return "", errors.New("执行超时, 强制结束")
+            return "", errTimeout
+        case codes.Canceled:
+            return "", errCanceled
     }
     return "", err
 }
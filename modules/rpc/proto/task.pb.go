@@ -34,8 +34,9 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type TaskRequest struct {
-	Command string `protobuf:"bytes,2,opt,name=command" json:"command,omitempty"`
-	Timeout int32  `protobuf:"varint,3,opt,name=timeout" json:"timeout,omitempty"`
+	Command string            `protobuf:"bytes,2,opt,name=command" json:"command,omitempty"`
+	Timeout int32             `protobuf:"varint,3,opt,name=timeout" json:"timeout,omitempty"`
+	Env     map[string]string `protobuf:"bytes,4,rep,name=env" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
 
 func (m *TaskRequest) Reset()                    { *m = TaskRequest{} }
@@ -57,6 +58,13 @@ func (m *TaskRequest) GetTimeout() int32 {
 	return 0
 }
 
+func (m *TaskRequest) GetEnv() map[string]string {
+	if m != nil {
+		return m.Env
+	}
+	return nil
+}
+
 type TaskResponse struct {
 	Output string `protobuf:"bytes,1,opt,name=output" json:"output,omitempty"`
 	Error  string `protobuf:"bytes,2,opt,name=error" json:"error,omitempty"`
@@ -161,16 +169,19 @@ var _Task_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("task.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 170 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x8f, 0xb1, 0x0e, 0x82, 0x40,
-	0x0c, 0x86, 0x45, 0x04, 0x63, 0x75, 0xd0, 0xc6, 0x98, 0x8b, 0x13, 0x61, 0x62, 0x30, 0x0c, 0xea,
-	0xe8, 0xe2, 0x2b, 0x5c, 0x7c, 0x01, 0xc4, 0x1b, 0x0c, 0x81, 0x9e, 0xbd, 0xde, 0xfb, 0x1b, 0x38,
-	0x48, 0x18, 0xbf, 0x36, 0xfd, 0xfa, 0xff, 0x00, 0x52, 0xb9, 0xa6, 0xb4, 0x4c, 0x42, 0x18, 0xb3,
-	0xad, 0xf3, 0x27, 0x6c, 0x5f, 0x95, 0x6b, 0xb4, 0xf9, 0x79, 0xe3, 0x04, 0x15, 0xac, 0x6b, 0x6a,
-	0xdb, 0xaa, 0xfb, 0xa8, 0x65, 0x16, 0x15, 0x1b, 0x3d, 0x61, 0xbf, 0x91, 0x6f, 0x6b, 0xc8, 0x8b,
-	0x8a, 0xb3, 0xa8, 0x48, 0xf4, 0x84, 0xf9, 0x03, 0x76, 0x41, 0xe1, 0x2c, 0x75, 0xce, 0xe0, 0x09,
-	0x52, 0xf2, 0x62, 0xbd, 0xa8, 0x68, 0x50, 0x8c, 0x84, 0x47, 0x48, 0x0c, 0x33, 0xf1, 0x68, 0x0e,
-	0x70, 0xbd, 0xc3, 0xaa, 0xbf, 0xc6, 0x0b, 0xc4, 0xda, 0x77, 0xb8, 0x2f, 0xd9, 0xd6, 0xe5, 0x2c,
-	0xd2, 0xf9, 0x30, 0x9b, 0x84, 0x0f, 0xf9, 0xe2, 0x9d, 0x0e, 0x15, 0x6e, 0xff, 0x00, 0x00, 0x00,
-	0xff, 0xff, 0xef, 0x3c, 0x71, 0x6b, 0xd0, 0x00, 0x00, 0x00,
+	// 220 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5d, 0x90, 0x4d, 0x0a, 0xc2, 0x30,
+	0x10, 0x85, 0xad, 0xb1, 0x55, 0x47, 0x17, 0x1a, 0x44, 0x62, 0x57, 0xd2, 0x95, 0xa0, 0x64, 0xa1,
+	0x22, 0x22, 0x6e, 0x7b, 0x81, 0xe0, 0x05, 0xaa, 0x66, 0x21, 0xb5, 0x49, 0x4d, 0xd3, 0x42, 0x2f,
+	0xe4, 0x39, 0x4d, 0xfa, 0x03, 0xc5, 0xdd, 0xbc, 0x37, 0x33, 0xdf, 0x1b, 0x06, 0x40, 0x47, 0x59,
+	0x4c, 0x53, 0x25, 0xb5, 0xc4, 0x48, 0xa5, 0x8f, 0xe0, 0xeb, 0xc0, 0xe4, 0x66, 0x3c, 0xc6, 0x3f,
+	0x39, 0xcf, 0x34, 0x26, 0x30, 0x7c, 0xc8, 0x24, 0x89, 0xc4, 0x93, 0xf4, 0xd7, 0xce, 0x66, 0xcc,
+	0x5a, 0x69, 0x3b, 0xfa, 0x95, 0x70, 0x99, 0x6b, 0x82, 0x4c, 0xc7, 0x65, 0xad, 0xc4, 0x5b, 0x40,
+	0x5c, 0x14, 0x64, 0xb0, 0x46, 0x9b, 0xc9, 0x7e, 0x45, 0x0d, 0x96, 0x76, 0x90, 0x34, 0x14, 0x45,
+	0x28, 0xb4, 0x2a, 0x99, 0x9d, 0xf2, 0x4f, 0x30, 0x6a, 0x0d, 0x3c, 0x03, 0x14, 0xf3, 0x92, 0x38,
+	0x55, 0x90, 0x2d, 0xf1, 0x02, 0xdc, 0x22, 0x7a, 0xe7, 0xbc, 0x09, 0xaf, 0xc5, 0xa5, 0x7f, 0x76,
+	0x82, 0x2b, 0x4c, 0x6b, 0x68, 0x96, 0x4a, 0x91, 0x71, 0xbc, 0x04, 0xcf, 0x64, 0xa7, 0xe6, 0x9a,
+	0x7a, 0xbd, 0x51, 0x96, 0xc0, 0x95, 0x92, 0xaa, 0x25, 0x54, 0x62, 0x7f, 0x84, 0x81, 0xdd, 0xc6,
+	0x3b, 0x40, 0x2c, 0x17, 0x78, 0xf6, 0x7f, 0xa4, 0x3f, 0xef, 0x38, 0x75, 0x42, 0xd0, 0xbb, 0x7b,
+	0xd5, 0xa3, 0x0e, 0x3f, 0xf5, 0x3b, 0xa2, 0xdf, 0x36, 0x01, 0x00, 0x00,
 }
@@ -19,7 +19,7 @@ func (s Server) Run(ctx context.Context, req *pb.TaskRequest) (*pb.TaskResponse,
             grpclog.Println(err)
         }
     } ()
-    output, err := utils.ExecShell(ctx, req.Command)
+    output, err := utils.ExecShell(ctx, req.Command, req.Env)
     resp := new(pb.TaskResponse)
     resp.Output = output
     if err != nil {
@@ -0,0 +1,250 @@
+package scheduler
+
+// 定时任务调度器
+// 任务以ID为索引存储, 下次执行时间使用最小堆维护, 添加、删除、更新任务时间复杂度均为O(log n)
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// 计算下次执行时间, 无法计算时返回零值
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// 调度执行的任务, scheduledTime为计划执行时间
+type Job interface {
+	Run(scheduledTime time.Time)
+}
+
+type FuncJob func(scheduledTime time.Time)
+
+func (f FuncJob) Run(scheduledTime time.Time) { f(scheduledTime) }
+
+type Entry struct {
+	Id       int
+	Schedule Schedule
+	Job      Job
+	Next     time.Time // 下次执行时间
+	Prev     time.Time // 上次执行时间
+	index    int       // 在堆中的位置, -1表示不在堆中
+}
+
+type Scheduler struct {
+	entries map[int]*Entry
+	queue   entryQueue
+	running bool
+	wakeup  chan struct{}
+	stop    chan struct{}
+	sync.Mutex
+}
+
+func New() *Scheduler {
+	return &Scheduler{
+		entries: make(map[int]*Entry),
+		queue:   make(entryQueue, 0),
+		wakeup:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// 添加任务, 任务已存在则替换
+func (s *Scheduler) Add(id int, schedule Schedule, job Job) {
+	s.Lock()
+	defer s.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		entry = &Entry{Id: id, index: -1}
+		s.entries[id] = entry
+	}
+	entry.Schedule = schedule
+	entry.Job = job
+	entry.Next = schedule.Next(time.Now())
+	s.fix(entry)
+	s.notify()
+}
+
+// 删除任务
+func (s *Scheduler) Remove(id int) {
+	s.Lock()
+	defer s.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return
+	}
+	delete(s.entries, id)
+	if entry.index >= 0 {
+		heap.Remove(&s.queue, entry.index)
+	}
+	s.notify()
+}
+
+// 删除所有任务
+func (s *Scheduler) Clear() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.entries = make(map[int]*Entry)
+	s.queue = make(entryQueue, 0)
+	s.notify()
+}
+
+// 任务是否存在
+func (s *Scheduler) Has(id int) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.entries[id]
+
+	return ok
+}
+
+// 获取任务快照
+func (s *Scheduler) Entry(id int) (Entry, bool) {
+	s.Lock()
+	defer s.Unlock()
+	entry, ok := s.entries[id]
+	if !ok {
+		return Entry{}, false
+	}
+
+	return *entry, true
+}
+
+// 任务数量
+func (s *Scheduler) Len() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.entries)
+}
+
+// 开始调度
+func (s *Scheduler) Start() {
+	s.Lock()
+	defer s.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	now := time.Now()
+	for _, entry := range s.entries {
+		next := entry.Schedule.Next(now)
+		// 单次执行的任务添加后到开始调度前已到期, 保留原执行时间, 开始调度后立即执行
+		if next.IsZero() && !entry.Next.IsZero() {
+			next = entry.Next
+		}
+		entry.Next = next
+		s.fix(entry)
+	}
+	go s.run()
+}
+
+// 停止调度, 不影响正在执行中的任务
+func (s *Scheduler) Stop() {
+	s.Lock()
+	if !s.running {
+		s.Unlock()
+		return
+	}
+	s.running = false
+	s.Unlock()
+	s.stop <- struct{}{}
+}
+
+func (s *Scheduler) run() {
+	for {
+		s.Lock()
+		// 没有任务时长时间休眠, 添加任务会唤醒
+		delay := 24 * time.Hour
+		if len(s.queue) > 0 {
+			delay = s.queue[0].Next.Sub(time.Now())
+		}
+		s.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case now := <-timer.C:
+			s.runDue(now)
+		case <-s.wakeup:
+			timer.Stop()
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// 执行所有到期的任务
+func (s *Scheduler) runDue(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	for len(s.queue) > 0 {
+		entry := s.queue[0]
+		if entry.Next.After(now) {
+			break
+		}
+		go entry.Job.Run(entry.Next)
+		entry.Prev = entry.Next
+		entry.Next = entry.Schedule.Next(now)
+		s.fix(entry)
+	}
+}
+
+// 调整任务在堆中的位置, 无下次执行时间的任务移出堆
+func (s *Scheduler) fix(entry *Entry) {
+	if entry.Next.IsZero() {
+		if entry.index >= 0 {
+			heap.Remove(&s.queue, entry.index)
+		}
+		return
+	}
+	if entry.index >= 0 {
+		heap.Fix(&s.queue, entry.index)
+		return
+	}
+	heap.Push(&s.queue, entry)
+}
+
+// 唤醒调度协程重新计算休眠时间
+func (s *Scheduler) notify() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// 按下次执行时间排序的最小堆
+type entryQueue []*Entry
+
+func (q entryQueue) Len() int { return len(q) }
+
+func (q entryQueue) Less(i, j int) bool {
+	return q[i].Next.Before(q[j].Next)
+}
+
+func (q entryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *entryQueue) Push(x interface{}) {
+	entry := x.(*Entry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *entryQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*q = old[:n-1]
+
+	return entry
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+// 固定间隔执行
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func TestSchedulerRun(t *testing.T) {
+	s := New()
+	result := make(chan int, 10)
+	s.Add(1, every(50*time.Millisecond), FuncJob(func(time.Time) { result <- 1 }))
+	s.Add(2, every(time.Hour), FuncJob(func(time.Time) { result <- 2 }))
+	s.Start()
+	defer s.Stop()
+
+	select {
+	case id := <-result:
+		if id != 1 {
+			t.Fatalf("执行任务不匹配, 目标1, 实际%d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("任务未按时执行")
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	s := New()
+	result := make(chan int, 10)
+	s.Add(1, every(50*time.Millisecond), FuncJob(func(time.Time) { result <- 1 }))
+	s.Start()
+	defer s.Stop()
+	s.Remove(1)
+	if s.Has(1) || s.Len() != 0 {
+		t.Fatal("任务删除失败")
+	}
+
+	select {
+	case <-result:
+		t.Fatal("已删除的任务被执行")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSchedulerUpdate(t *testing.T) {
+	s := New()
+	s.Add(1, every(time.Hour), FuncJob(func(time.Time) {}))
+	s.Add(1, every(time.Minute), FuncJob(func(time.Time) {}))
+	entry, ok := s.Entry(1)
+	if !ok || s.Len() != 1 {
+		t.Fatal("任务更新失败")
+	}
+	if entry.Next.Sub(time.Now()) > 2*time.Minute {
+		t.Fatalf("下次执行时间未更新-%s", entry.Next)
+	}
+}
+
+func addEntries(s *Scheduler, n int) {
+	job := FuncJob(func(time.Time) {})
+	for i := 0; i < n; i++ {
+		s.Add(i, every(time.Duration(i+1)*time.Minute), job)
+	}
+}
+
+func benchmarkAdd(b *testing.B, n int) {
+	s := New()
+	addEntries(s, n)
+	job := FuncJob(func(time.Time) {})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Add(n+i, every(time.Duration(i%n+1)*time.Minute), job)
+	}
+}
+
+func benchmarkUpdate(b *testing.B, n int) {
+	s := New()
+	addEntries(s, n)
+	job := FuncJob(func(time.Time) {})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Add(i%n, every(time.Duration(n-i%n)*time.Minute), job)
+	}
+}
+
+func benchmarkRemove(b *testing.B, n int) {
+	s := New()
+	addEntries(s, n)
+	job := FuncJob(func(time.Time) {})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := i % n
+		s.Remove(id)
+		b.StopTimer()
+		s.Add(id, every(time.Duration(id+1)*time.Minute), job)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkAdd10k(b *testing.B)     { benchmarkAdd(b, 10000) }
+func BenchmarkAdd100k(b *testing.B)    { benchmarkAdd(b, 100000) }
+func BenchmarkUpdate10k(b *testing.B)  { benchmarkUpdate(b, 10000) }
+func BenchmarkUpdate100k(b *testing.B) { benchmarkUpdate(b, 100000) }
+func BenchmarkRemove10k(b *testing.B)  { benchmarkRemove(b, 10000) }
+func BenchmarkRemove100k(b *testing.B) { benchmarkRemove(b, 100000) }
@@ -35,6 +35,14 @@ type Setting struct {
 	CAFile    string `split_words:"true"`
 	CertFile  string `split_words:"true"`
 	KeyFile   string `split_words:"true"`
+
+	HaEnable   bool `split_words:"true"` // 开启调度器主备模式
+	HaLeaseTtl int  `split_words:"true"` // 主节点租约有效期(秒)
+
+	ShutdownTimeout int  `split_words:"true"` // 应用退出时等待任务执行完成的最长时间(秒), 0不限制
+	OrphanNotify    bool `split_words:"true"` // 调度器异常退出遗留的任务日志被标记为异常中止时, 是否发送失败通知
+
+	CallbackUrl string `split_words:"true"` // gocron对外访问地址, 用于生成异步HTTP任务回调地址, 如http://gocron.example.com:5920
 }
 
 // 读取配置
@@ -80,6 +88,14 @@ func ReadIni(filename string) (*Setting, error) {
 	s.CertFile = section.Key("cert_file").MustString("")
 	s.KeyFile = section.Key("key_file").MustString("")
 
+	s.HaEnable = section.Key("ha.enable").MustBool(false)
+	s.HaLeaseTtl = section.Key("ha.lease.ttl").MustInt(10)
+
+	s.ShutdownTimeout = section.Key("shutdown.timeout").MustInt(0)
+	s.OrphanNotify = section.Key("orphan.notify").MustBool(false)
+
+	s.CallbackUrl = section.Key("callback.url").MustString("")
+
 	if s.EnableTLS {
 		if !utils.FileExist(s.CAFile) {
 			logger.Fatalf("failed to read ca cert file: %s", s.CAFile)
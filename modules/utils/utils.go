@@ -101,6 +101,19 @@ func FileExist(file string) bool {
     return true
 }
 
+// 在当前进程环境变量基础上追加环境变量, 未设置时返回nil, 命令继承当前进程环境变量
+func commandEnv(env map[string]string) []string {
+    if len(env) == 0 {
+        return nil
+    }
+    result := os.Environ()
+    for key, value := range env {
+        result = append(result, key + "=" + value)
+    }
+
+    return result
+}
+
 // 格式化环境变量
 func FormatUnixEnv(key, value string) string {
     return fmt.Sprintf("export %s=%s; ", key, value)
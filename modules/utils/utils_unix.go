@@ -15,11 +15,12 @@ type Result struct {
 }
 
 // 执行shell命令，可设置执行超时时间
-func ExecShell(ctx context.Context, command string) (string, error)  {
+func ExecShell(ctx context.Context, command string, env map[string]string) (string, error)  {
     cmd := exec.Command("/bin/bash", "-c", command)
     cmd.SysProcAttr = &syscall.SysProcAttr{
         Setpgid: true,
     }
+    cmd.Env = commandEnv(env)
     var resultChan chan Result = make(chan Result)
     go func() {
         output ,err := cmd.CombinedOutput()
@@ -16,12 +16,13 @@ type Result struct {
 }
 
 // 执行shell命令，可设置执行超时时间
-func ExecShell(ctx context.Context, command string) (string, error)  {
+func ExecShell(ctx context.Context, command string, env map[string]string) (string, error)  {
     cmd := exec.Command("cmd", "/C", command)
     // 隐藏cmd窗口
     cmd.SysProcAttr = &syscall.SysProcAttr{
         HideWindow: true,
     }
+    cmd.Env = commandEnv(env)
     var resultChan chan Result = make(chan Result)
     go func() {
         output ,err := cmd.CombinedOutput()
@@ -0,0 +1,253 @@
+package calendar
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/ical"
+	"gocron/modules/logger"
+	"gocron/modules/utils"
+	"gocron/routers/base"
+
+	"github.com/Unknwon/paginater"
+	"github.com/go-macaron/binding"
+	"gopkg.in/macaron.v1"
+)
+
+func Index(ctx *macaron.Context) {
+	calendarModel := new(models.Calendar)
+	queryParams := parseQueryParams(ctx)
+	total, err := calendarModel.Total(queryParams)
+	calendars, err := calendarModel.List(queryParams)
+	if err != nil {
+		logger.Error(err)
+	}
+	PageParams := fmt.Sprintf("id=%d&name=%s&page_size=%d",
+		queryParams["Id"], template.HTMLEscapeString(queryParams["Name"].(string)), queryParams["PageSize"])
+	queryParams["PageParams"] = template.URL(PageParams)
+	p := paginater.New(int(total), queryParams["PageSize"].(int), queryParams["Page"].(int), 5)
+	ctx.Data["Pagination"] = p
+	ctx.Data["Title"] = "日历列表"
+	ctx.Data["Calendars"] = calendars
+	ctx.Data["Params"] = queryParams
+	ctx.HTML(200, "calendar/index")
+}
+
+func Create(ctx *macaron.Context) {
+	ctx.Data["Title"] = "添加日历"
+	ctx.HTML(200, "calendar/calendar_form")
+}
+
+func Edit(ctx *macaron.Context) {
+	ctx.Data["Title"] = "编辑日历"
+	calendarModel := new(models.Calendar)
+	id := ctx.ParamsInt(":id")
+	err := calendarModel.Find(id)
+	if err != nil {
+		logger.Errorf("获取日历详情失败#日历id-%d", id)
+	}
+	ctx.Data["Calendar"] = calendarModel
+	ctx.HTML(200, "calendar/calendar_form")
+}
+
+type CalendarForm struct {
+	Id     int
+	Name   string `binding:"Required;MaxSize(64)"`
+	Remark string `binding:"MaxSize(100)"`
+}
+
+func (f CalendarForm) Error(ctx *macaron.Context, errs binding.Errors) {
+	if len(errs) == 0 {
+		return
+	}
+	json := utils.JsonResponse{}
+	content := json.CommonFailure("表单验证失败, 请检测输入")
+
+	ctx.Resp.Write([]byte(content))
+}
+
+func Store(ctx *macaron.Context, form CalendarForm) string {
+	json := utils.JsonResponse{}
+	calendarModel := new(models.Calendar)
+	name := strings.TrimSpace(form.Name)
+	nameExist, err := calendarModel.NameExists(name, form.Id)
+	if err != nil {
+		return json.CommonFailure("操作失败", err)
+	}
+	if nameExist {
+		return json.CommonFailure("日历名称已存在")
+	}
+
+	calendarModel.Name = name
+	calendarModel.Remark = strings.TrimSpace(form.Remark)
+	if form.Id > 0 {
+		_, err = calendarModel.UpdateBean(form.Id)
+	} else {
+		_, err = calendarModel.Create()
+	}
+	if err != nil {
+		return json.CommonFailure("保存失败", err)
+	}
+
+	return json.Success("保存成功", nil)
+}
+
+func Remove(ctx *macaron.Context) string {
+	id, err := strconv.Atoi(ctx.Params(":id"))
+	json := utils.JsonResponse{}
+	if err != nil {
+		return json.CommonFailure("参数错误", err)
+	}
+	calendarModel := new(models.Calendar)
+	referenced, err := calendarModel.IdReferenced(id)
+	if err != nil {
+		return json.CommonFailure("操作失败", err)
+	}
+	if referenced {
+		return json.CommonFailure("有任务引用此日历，不能删除")
+	}
+	_, err = calendarModel.Delete(id)
+	if err != nil {
+		return json.CommonFailure("操作失败", err)
+	}
+
+	return json.Success("操作成功", nil)
+}
+
+// 日历日期列表
+func Dates(ctx *macaron.Context) {
+	id := ctx.ParamsInt(":id")
+	calendarModel := new(models.Calendar)
+	err := calendarModel.Find(id)
+	if err != nil || calendarModel.Id <= 0 {
+		ctx.Redirect("/calendar")
+		return
+	}
+	calendarDateModel := new(models.CalendarDate)
+	dates, err := calendarDateModel.ListByCalendarId(id)
+	if err != nil {
+		logger.Error(err)
+	}
+	ctx.Data["Title"] = "日历日期"
+	ctx.Data["Calendar"] = calendarModel
+	ctx.Data["Dates"] = dates
+	ctx.HTML(200, "calendar/dates")
+}
+
+type CalendarDateForm struct {
+	CalendarId int                     `binding:"Required"`
+	Type       models.CalendarDateType `binding:"In(1,2)"`
+	StartDate  string                  `binding:"Required"`
+	EndDate    string
+	Name       string `binding:"MaxSize(128)"`
+}
+
+func (f CalendarDateForm) Error(ctx *macaron.Context, errs binding.Errors) {
+	if len(errs) == 0 {
+		return
+	}
+	json := utils.JsonResponse{}
+	content := json.CommonFailure("表单验证失败, 请检测输入")
+
+	ctx.Resp.Write([]byte(content))
+}
+
+func StoreDate(ctx *macaron.Context, form CalendarDateForm) string {
+	json := utils.JsonResponse{}
+	calendarModel := new(models.Calendar)
+	err := calendarModel.Find(form.CalendarId)
+	if err != nil || calendarModel.Id <= 0 {
+		return json.CommonFailure("日历不存在")
+	}
+	startDate, err := time.Parse(models.CalendarDateFormat, strings.TrimSpace(form.StartDate))
+	if err != nil {
+		return json.CommonFailure("开始日期格式错误, 格式为2006-01-02")
+	}
+	endDate := startDate
+	if strings.TrimSpace(form.EndDate) != "" {
+		endDate, err = time.Parse(models.CalendarDateFormat, strings.TrimSpace(form.EndDate))
+		if err != nil {
+			return json.CommonFailure("结束日期格式错误, 格式为2006-01-02")
+		}
+	}
+	if endDate.Before(startDate) {
+		return json.CommonFailure("结束日期不能早于开始日期")
+	}
+
+	calendarDateModel := new(models.CalendarDate)
+	calendarDateModel.CalendarId = form.CalendarId
+	calendarDateModel.Type = form.Type
+	calendarDateModel.StartDate = startDate.Format(models.CalendarDateFormat)
+	calendarDateModel.EndDate = endDate.Format(models.CalendarDateFormat)
+	calendarDateModel.Name = strings.TrimSpace(form.Name)
+	_, err = calendarDateModel.Create()
+
+	return utils.JsonResponseByErr(err)
+}
+
+func RemoveDate(ctx *macaron.Context) string {
+	id := ctx.ParamsInt(":id")
+	calendarDateModel := new(models.CalendarDate)
+	_, err := calendarDateModel.Delete(id)
+
+	return utils.JsonResponseByErr(err)
+}
+
+// 从iCal文件导入日期
+func Import(ctx *macaron.Context) string {
+	json := utils.JsonResponse{}
+	calendarId := ctx.ParamsInt(":id")
+	calendarModel := new(models.Calendar)
+	err := calendarModel.Find(calendarId)
+	if err != nil || calendarModel.Id <= 0 {
+		return json.CommonFailure("日历不存在")
+	}
+	dateType := models.CalendarDateType(ctx.QueryInt("type"))
+	if dateType != models.CalendarDateInclude && dateType != models.CalendarDateExclude {
+		return json.CommonFailure("请选择日期类型")
+	}
+	content := ctx.Query("content")
+	if strings.TrimSpace(content) == "" {
+		return json.CommonFailure("请选择iCal文件")
+	}
+	events, err := ical.Parse(content)
+	if err != nil {
+		return json.CommonFailure("解析iCal文件失败-" + err.Error())
+	}
+
+	dates := make([]models.CalendarDate, len(events))
+	for i, event := range events {
+		name := []rune(event.Summary)
+		if len(name) > 128 {
+			name = name[:128]
+		}
+		dates[i] = models.CalendarDate{
+			CalendarId: calendarId,
+			Type:       dateType,
+			StartDate:  event.StartDate.Format(models.CalendarDateFormat),
+			EndDate:    event.EndDate.Format(models.CalendarDateFormat),
+			Name:       string(name),
+		}
+	}
+	calendarDateModel := new(models.CalendarDate)
+	_, err = calendarDateModel.BatchCreate(dates)
+	if err != nil {
+		return json.CommonFailure("导入失败", err)
+	}
+
+	return json.Success(fmt.Sprintf("成功导入%d条", len(dates)), nil)
+}
+
+// 解析查询参数
+func parseQueryParams(ctx *macaron.Context) models.CommonMap {
+	var params models.CommonMap = models.CommonMap{}
+	params["Id"] = ctx.QueryInt("id")
+	params["Name"] = ctx.QueryTrim("name")
+	base.ParsePageAndPageSize(ctx, params)
+
+	return params
+}
@@ -16,6 +16,7 @@ import (
     "strings"
     "gocron/modules/rpc/client"
     "gocron/modules/rpc/proto"
+    "golang.org/x/net/context"
 )
 
 func Index(ctx *macaron.Context)  {
@@ -64,6 +65,7 @@ type HostForm struct {
     Name string `binding:"Required;MaxSize(64)"`
     Alias string `binding:"Required;MaxSize(32)"`
     Port int `binding:"Required;Range(1-65535)"`
+    MaxConcurrency int `binding:"Range(0,10000)"`
     Remark string
 }
 
@@ -92,6 +94,7 @@ func Store(ctx *macaron.Context, form HostForm) string  {
     hostModel.Name = strings.TrimSpace(form.Name)
     hostModel.Alias = strings.TrimSpace(form.Alias)
     hostModel.Port = form.Port
+    hostModel.MaxConcurrency = form.MaxConcurrency
     hostModel.Remark = strings.TrimSpace(form.Remark)
     isCreate := false
     oldHostModel := new(models.Host)
@@ -110,6 +113,11 @@ func Store(ctx *macaron.Context, form HostForm) string  {
         return json.CommonFailure("保存失败", err)
     }
 
+    serviceTask := new(service.Task)
+    if isCreate || oldHostModel.MaxConcurrency != hostModel.MaxConcurrency {
+        serviceTask.ReloadConcurrencyLimits()
+    }
+
     if !isCreate {
         oldAddr := fmt.Sprintf("%s:%d", oldHostModel.Name, oldHostModel.Port)
         newAddr := fmt.Sprintf("%s:%d", hostModel.Name, hostModel.Port)
@@ -122,7 +130,6 @@ func Store(ctx *macaron.Context, form HostForm) string  {
         if  err != nil {
             return json.CommonFailure("刷新任务主机信息失败", err)
         }
-        serviceTask := new(service.Task)
         serviceTask.BatchAdd(tasks)
     }
 
@@ -175,7 +182,7 @@ func Ping(ctx *macaron.Context) string  {
     taskReq := &rpc.TaskRequest{}
     taskReq.Command = "echo hello"
     taskReq.Timeout = 10
-    output, err := client.Exec(hostModel.Name, hostModel.Port, taskReq)
+    output, err := client.Exec(context.Background(), hostModel.Name, hostModel.Port, taskReq)
     if err != nil {
         return json.CommonFailure("连接失败-" + err.Error() + " " + output, err)
     }
@@ -113,6 +113,7 @@ func Store(ctx *macaron.Context, form InstallForm) string {
 	app.Installed = true
 	// 初始化定时任务
 	serviceTask := new(service.Task)
+	serviceTask.RegisterInstance()
 	serviceTask.Initialize()
 
 	return json.Success("安装成功", nil)
@@ -139,6 +140,11 @@ func writeConfig(form InstallForm) error {
 		"ca_file", "",
 		"cert_file", "",
 		"key_file", "",
+		"ha.enable", "false",
+		"ha.lease.ttl", "10",
+		"shutdown.timeout", "0",
+		"orphan.notify", "false",
+		"callback.url", "",
 	}
 
 	return setting.Write(dbConfig, app.AppConfig)
@@ -6,6 +6,7 @@ import (
     "gocron/models"
     "gocron/modules/logger"
     "encoding/json"
+    "gocron/service"
 )
 
 
@@ -135,4 +136,71 @@ func RemoveMailUser(ctx *macaron.Context) string  {
     return utils.JsonResponseByErr(err)
 }
 
-// endregion
\ No newline at end of file
+// endregion
+// region 并发数限制
+
+func EditConcurrency(ctx *macaron.Context)  {
+    ctx.Data["Title"] = "并发数限制"
+    settingModel := new(models.Setting)
+    concurrency, err := settingModel.Concurrency()
+    if err != nil {
+        logger.Error(err)
+    }
+    ctx.Data["Concurrency"] = concurrency
+    ctx.HTML(200, "manage/concurrency")
+}
+
+func UpdateConcurrencyGlobal(ctx *macaron.Context) string {
+    limit := ctx.QueryInt("global")
+    if limit < 0 || limit > 10000 {
+        json := utils.JsonResponse{}
+
+        return json.CommonFailure("全局最大并发数取值0-10000")
+    }
+    settingModel := new(models.Setting)
+    _, err := settingModel.UpdateConcurrencyGlobal(limit)
+    if err == nil {
+        serviceTask := new(service.Task)
+        serviceTask.ReloadConcurrencyLimits()
+    }
+
+    return utils.JsonResponseByErr(err)
+}
+
+func CreateTagConcurrency(ctx *macaron.Context) string  {
+    tag := ctx.QueryTrim("tag")
+    limit := ctx.QueryInt("limit")
+    json := utils.JsonResponse{}
+    if tag == "" || limit <= 0 || limit > 10000 {
+        return json.CommonFailure("标签不能为空, 最大并发数取值1-10000")
+    }
+    settingModel := new(models.Setting)
+    exist, err := settingModel.IsTagConcurrencyExist(tag)
+    if err != nil {
+        return json.CommonFailure("操作失败", err)
+    }
+    if exist {
+        return json.CommonFailure("标签已设置并发数限制")
+    }
+    _, err = settingModel.CreateTagConcurrency(tag, limit)
+    if err == nil {
+        serviceTask := new(service.Task)
+        serviceTask.ReloadConcurrencyLimits()
+    }
+
+    return utils.JsonResponseByErr(err)
+}
+
+func RemoveTagConcurrency(ctx *macaron.Context) string  {
+    id := ctx.ParamsInt(":id")
+    settingModel := new(models.Setting)
+    _, err := settingModel.RemoveTagConcurrency(id)
+    if err == nil {
+        serviceTask := new(service.Task)
+        serviceTask.ReloadConcurrencyLimits()
+    }
+
+    return utils.JsonResponseByErr(err)
+}
+
+// endregion
@@ -2,6 +2,8 @@ package routers
 
 import (
 	"gocron/modules/app"
+	"gocron/modules/logger"
+	"gocron/service"
 	"net/http"
 
 	"gopkg.in/macaron.v1"
@@ -9,7 +11,18 @@ import (
 
 // 首页
 func Monitor(ctx *macaron.Context) {
-	ctx.JSON(http.StatusOK, map[string]interface{}{
+	data := map[string]interface{}{
 		"version": app.VersionId,
-	})
+	}
+	if app.Installed {
+		leaderId, err := service.LeaderId()
+		if err != nil {
+			logger.Error("获取主节点失败", err)
+		}
+		data["instance"] = app.InstanceId
+		data["leader"] = leaderId
+		data["is_leader"] = service.IsLeader()
+		data["ha_enable"] = app.Setting.HaEnable
+	}
+	ctx.JSON(http.StatusOK, data)
 }
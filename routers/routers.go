@@ -4,6 +4,7 @@ import (
 	"gocron/modules/app"
 	"gocron/modules/logger"
 	"gocron/modules/utils"
+	"gocron/routers/calendar"
 	"gocron/routers/host"
 	"gocron/routers/install"
 	"gocron/routers/loginlog"
@@ -11,6 +12,7 @@ import (
 	"gocron/routers/task"
 	"gocron/routers/tasklog"
 	"gocron/routers/user"
+	"gocron/routers/workflow"
 	"html/template"
 	"strconv"
 	"strings"
@@ -59,10 +61,17 @@ func Register(m *macaron.Macaron) {
 		m.Get("", task.Index)
 		m.Get("/log", tasklog.Index)
 		m.Post("/log/clear", tasklog.Clear)
+		m.Get("/log/attempts/:id", tasklog.Attempts)
+		m.Get("/workflow", workflow.Index)
+		m.Get("/workflow/:id", workflow.Detail)
 		m.Post("/remove/:id", task.Remove)
 		m.Post("/enable/:id", task.Enable)
 		m.Post("/disable/:id", task.Disable)
 		m.Get("/run/:id", task.Run)
+		m.Post("/backfill/:id", binding.Bind(task.BackfillForm{}), task.Backfill)
+		m.Get("/delayed", task.DelayedIndex)
+		m.Post("/delay/:id", binding.Bind(task.DelayForm{}), task.Delay)
+		m.Post("/delay/cancel/:id", task.CancelDelay)
 	})
 
 	// 主机
@@ -75,6 +84,19 @@ func Register(m *macaron.Macaron) {
 		m.Post("/remove/:id", host.Remove)
 	})
 
+	// 日历
+	m.Group("/calendar", func() {
+		m.Get("/create", calendar.Create)
+		m.Get("/edit/:id", calendar.Edit)
+		m.Post("/store", binding.Bind(calendar.CalendarForm{}), calendar.Store)
+		m.Get("", calendar.Index)
+		m.Post("/remove/:id", calendar.Remove)
+		m.Get("/dates/:id", calendar.Dates)
+		m.Post("/date/store", binding.Bind(calendar.CalendarDateForm{}), calendar.StoreDate)
+		m.Post("/date/remove/:id", calendar.RemoveDate)
+		m.Post("/import/:id", calendar.Import)
+	})
+
 	// 管理
 	m.Group("/manage", func() {
 		m.Group("/slack", func() {
@@ -92,6 +114,12 @@ func Register(m *macaron.Macaron) {
 			m.Post("/user", manage.CreateMailUser)
 			m.Post("/user/remove/:id", manage.RemoveMailUser)
 		})
+		m.Group("/concurrency", func() {
+			m.Get("/edit", manage.EditConcurrency)
+			m.Post("/global", manage.UpdateConcurrencyGlobal)
+			m.Post("/tag", manage.CreateTagConcurrency)
+			m.Post("/tag/remove/:id", manage.RemoveTagConcurrency)
+		})
 		m.Get("/login-log", loginlog.Index)
 	})
 
@@ -100,8 +128,15 @@ func Register(m *macaron.Macaron) {
 		m.Post("/tasklog/remove/:id", tasklog.Remove)
 		m.Post("/task/enable/:id", task.Enable)
 		m.Post("/task/disable/:id", task.Disable)
+		m.Get("/workflow/:id", workflow.Nodes)
+		m.Post("/task/backfill/:id", binding.Bind(task.BackfillForm{}), task.Backfill)
+		m.Post("/task/delay/:id", binding.Bind(task.DelayForm{}), task.Delay)
+		m.Post("/task/delay/cancel/:id", task.CancelDelay)
 	}, apiAuth)
 
+	// 异步HTTP任务回调, 使用一次性token验证
+	m.Post("/api/callback/:id", task.Callback)
+
 	// 404错误
 	m.NotFound(func(ctx *macaron.Context) {
 		if isGetRequest(ctx) && !isAjaxRequest(ctx) {
@@ -191,6 +226,10 @@ func ipAuth(ctx *macaron.Context) {
 	if allowIpsStr == "" {
 		return
 	}
+	// 异步HTTP任务回调由远程服务发起, 不限制IP
+	if strings.HasPrefix(ctx.Req.URL.Path, "/api/callback/") {
+		return
+	}
 	clientIp := ctx.RemoteAddr()
 	allowIps := strings.Split(allowIpsStr, ",")
 	if !utils.InStringSlice(allowIps, clientIp) {
@@ -0,0 +1,78 @@
+package task
+
+// 异步HTTP任务回调
+// POST /api/callback/:id, 支持表单或JSON请求体
+// token: 回调token, 也可通过请求头X-Gocron-Callback-Token提交
+// status: success或failure
+// output: 远程任务输出
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"gocron/modules/logger"
+	"gocron/modules/utils"
+	"gocron/service"
+
+	"gopkg.in/macaron.v1"
+)
+
+const (
+	callbackStatusSuccess = "success"
+	callbackStatusFailure = "failure"
+)
+
+// JSON请求体最大长度
+const maxCallbackBodySize = 2 * 1024 * 1024
+
+type callbackForm struct {
+	Token  string `json:"token"`
+	Status string `json:"status"`
+	Output string `json:"output"`
+}
+
+// 远程服务提交执行结果
+func Callback(ctx *macaron.Context) string {
+	id := ctx.ParamsInt64(":id")
+	json := utils.JsonResponse{}
+	form, err := parseCallbackForm(ctx)
+	if err != nil {
+		return json.CommonFailure("解析请求体失败", err)
+	}
+	if form.Status != callbackStatusSuccess && form.Status != callbackStatusFailure {
+		return json.CommonFailure("status必须为success或failure")
+	}
+
+	ok, err := service.CompleteCallback(id, form.Token, form.Status == callbackStatusSuccess, form.Output)
+	if err != nil {
+		logger.Error("异步HTTP任务回调#更新回调记录失败-", err)
+		return json.CommonFailure(utils.FailureContent, err)
+	}
+	if !ok {
+		return json.CommonFailure("回调地址无效、已过期或已使用")
+	}
+
+	return json.Success(utils.SuccessContent, nil)
+}
+
+func parseCallbackForm(ctx *macaron.Context) (callbackForm, error) {
+	form := callbackForm{}
+	if strings.Contains(ctx.Req.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(io.LimitReader(ctx.Req.Body().ReadCloser(), maxCallbackBodySize)).Decode(&form)
+		if err != nil {
+			return form, err
+		}
+	} else {
+		form.Token = ctx.Query("token")
+		form.Status = ctx.Query("status")
+		form.Output = ctx.Query("output")
+	}
+	if token := ctx.Req.Header.Get(service.CallbackTokenHeader); token != "" {
+		form.Token = token
+	}
+	form.Token = strings.TrimSpace(form.Token)
+	form.Status = strings.ToLower(strings.TrimSpace(form.Status))
+
+	return form, nil
+}
@@ -0,0 +1,107 @@
+package task
+
+// 延迟执行
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+	"gocron/modules/utils"
+	"gocron/routers/base"
+	"gocron/service"
+
+	"github.com/Unknwon/paginater"
+	"github.com/go-macaron/binding"
+	"gopkg.in/macaron.v1"
+)
+
+type DelayForm struct {
+	Delay int `binding:"Range(1,43200)"` // 延迟时间(单位分钟), 最长30天
+}
+
+func (f DelayForm) Error(ctx *macaron.Context, errs binding.Errors) {
+	if len(errs) == 0 {
+		return
+	}
+	json := utils.JsonResponse{}
+	content := json.CommonFailure("表单验证失败, 请检测输入")
+
+	ctx.Resp.Write([]byte(content))
+}
+
+// 延迟执行任务
+func Delay(ctx *macaron.Context, form DelayForm) string {
+	id := ctx.ParamsInt(":id")
+	json := utils.JsonResponse{}
+	taskModel := new(models.Task)
+	task, err := taskModel.Detail(id)
+	if err != nil || task.Id <= 0 {
+		return json.CommonFailure("获取任务详情失败", err)
+	}
+
+	serviceTask := new(service.Task)
+	delayedRunId, err := serviceTask.RunLater(task, time.Duration(form.Delay)*time.Minute, parseRunParams(ctx))
+	if err != nil {
+		return json.CommonFailure(err.Error())
+	}
+
+	return json.Success(fmt.Sprintf("任务将在%d分钟后执行", form.Delay), map[string]interface{}{
+		"Id": delayedRunId,
+	})
+}
+
+// 取消延迟执行
+func CancelDelay(ctx *macaron.Context) string {
+	id := ctx.ParamsInt(":id")
+	json := utils.JsonResponse{}
+	serviceTask := new(service.Task)
+	cancelled, err := serviceTask.CancelDelayed(id)
+	if err != nil {
+		return json.CommonFailure(utils.FailureContent, err)
+	}
+	if !cancelled {
+		return json.CommonFailure("延迟执行已执行或已取消")
+	}
+
+	return json.Success(utils.SuccessContent, nil)
+}
+
+// 延迟执行列表
+func DelayedIndex(ctx *macaron.Context) {
+	delayedRunModel := new(models.DelayedRun)
+	queryParams := parseDelayedQueryParams(ctx)
+	total, err := delayedRunModel.Total(queryParams)
+	if err != nil {
+		logger.Error(err)
+	}
+	runs, err := delayedRunModel.List(queryParams)
+	if err != nil {
+		logger.Error(err)
+	}
+	PageParams := fmt.Sprintf("task_id=%d&status=%d&page_size=%d",
+		queryParams["TaskId"], queryParams["Status"], queryParams["PageSize"])
+	queryParams["PageParams"] = template.URL(PageParams)
+	p := paginater.New(int(total), queryParams["PageSize"].(int), queryParams["Page"].(int), 5)
+	ctx.Data["Pagination"] = p
+	ctx.Data["Title"] = "延迟执行"
+	ctx.Data["Runs"] = runs
+	ctx.Data["Params"] = queryParams
+	ctx.HTML(200, "task/delayed")
+}
+
+// 解析查询参数
+func parseDelayedQueryParams(ctx *macaron.Context) models.CommonMap {
+	var params models.CommonMap = models.CommonMap{}
+	params["TaskId"] = ctx.QueryInt("task_id")
+	status := ctx.QueryInt("status")
+	if status >= 0 {
+		status -= 1
+	}
+	params["Status"] = status
+	base.ParsePageAndPageSize(ctx, params)
+
+	return params
+}
@@ -3,6 +3,7 @@ package task
 import (
     "gopkg.in/macaron.v1"
     "gocron/models"
+    "gocron/modules/app"
     "gocron/modules/logger"
     "gocron/modules/utils"
     "gocron/service"
@@ -14,20 +15,69 @@ import (
     "gocron/routers/base"
     "github.com/go-macaron/binding"
     "strings"
+    "errors"
+    "math"
+    "time"
 )
 
 type TaskForm struct {
     Id int
     Level models.TaskLevel `binding:"Required;In(1,2)"`
-    DependencyStatus models.TaskDependencyStatus
-    DependencyTaskId string
+    TriggerRule models.TaskTriggerRule
+    Dependencies string
     Name string `binding:"Required;MaxSize(32)"`
+    ScheduleType models.TaskScheduleType
     Spec string
+    RunAt string
+    Timezone string `binding:"MaxSize(64)"`
     Protocol models.TaskProtocol `binding:"In(1,2)"`
     Command string `binding:"Required;MaxSize(256)"`
+    Params string `binding:"MaxSize(1024)"`
+    HttpMethod string
+    HttpHeaders string `binding:"MaxSize(65535)"`
+    HttpQuery string `binding:"MaxSize(65535)"`
+    HttpBodyType models.TaskHttpBodyType `binding:"In(0,1,2)"`
+    HttpBody string `binding:"MaxSize(65535)"`
+    HttpAuthType models.TaskHttpAuthType `binding:"In(0,1,2)"`
+    HttpAuthUser string `binding:"MaxSize(128)"`
+    HttpAuthSecret string `binding:"MaxSize(512)"`
+    HttpSuccessCodes string
+    HttpBodyMatchType models.TaskHttpMatchType `binding:"In(0,1,2)"`
+    HttpBodyMatch string `binding:"MaxSize(512)"`
+    HttpJsonAssertions string `binding:"MaxSize(65535)"`
+    HttpMaxLatency int `binding:"Range(0,300000)"`
+    HttpAsync models.TaskHttpAsync `binding:"In(0,1,2)"`
+    CallbackTimeout int `binding:"Range(0,604800)"`
+    HttpJobIdPath string `binding:"MaxSize(256)"`
+    HttpPollUrl string `binding:"MaxSize(1024)"`
+    HttpPollInterval int `binding:"Range(0,3600)"`
+    HttpPollSuccess string `binding:"MaxSize(65535)"`
+    HttpPollFailure string `binding:"MaxSize(65535)"`
+    HttpCaCert string `binding:"MaxSize(65535)"`
+    HttpClientCert string `binding:"MaxSize(65535)"`
+    HttpClientKey string `binding:"MaxSize(65535)"`
+    HttpInsecureSkipVerify int8 `binding:"In(0,1)"`
+    HttpProxy string `binding:"MaxSize(256)"`
+    HttpRedirect models.TaskHttpRedirect `binding:"In(0,1,2)"`
     Timeout int `binding:"Range(0,86400)"`
-    Multi  int8 `binding:"In(1,2)"`
+    SlaDuration int `binding:"Range(0,86400)"`
+    SlaDeadline string
+    OverlapPolicy models.TaskOverlapPolicy `binding:"In(1,2,3,4)"`
+    MaxInstances int16
     RetryTimes int8
+    RetryPolicy models.TaskRetryPolicy `binding:"In(1,2,3)"`
+    RetryInterval int `binding:"Range(1,86400)"`
+    RetryMaxInterval int `binding:"Range(0,86400)"`
+    RetryJitter int8 `binding:"In(0,1)"`
+    RetryOn string
+    RetryExitCodes string
+    MisfirePolicy models.TaskMisfirePolicy `binding:"In(0,1,2)"`
+    MisfireLimit int16
+    CalendarIds string
+    FailureHookIds string
+    SuccessHookIds string
+    Jitter int `binding:"Range(0,3600)"`
+    JitterMode models.TaskJitterMode `binding:"In(1,2)"`
     HostId string
     Tag string
     Remark string
@@ -79,6 +129,8 @@ func Index(ctx *macaron.Context)  {
 // 新增页面
 func Create(ctx *macaron.Context)  {
     setHostsToTemplate(ctx)
+    setCalendarsToTemplate(ctx, "")
+    ctx.Data["HttpMethods"] = models.TaskHttpMethods
     ctx.Data["Title"] = "添加任务"
     ctx.HTML(200, "task/task_form")
 }
@@ -105,6 +157,14 @@ func Edit(ctx *macaron.Context)  {
         }
     }
 
+    setCalendarsToTemplate(ctx, task.CalendarIds)
+    dependencyModel := new(models.TaskDependency)
+    dependencies, err := dependencyModel.ListByTaskId(id)
+    if err != nil {
+        logger.Error(err)
+    }
+    ctx.Data["Dependencies"] = dependencies
+    ctx.Data["HttpMethods"] = models.TaskHttpMethods
     ctx.Data["Task"]  = task
     ctx.Data["Hosts"] = hosts
     ctx.Data["Title"] = "编辑"
@@ -131,21 +191,28 @@ func Store(ctx *macaron.Context, form TaskForm) string  {
     taskModel.Name = form.Name
     taskModel.Protocol = form.Protocol
     taskModel.Command = form.Command
+    taskModel.Params = strings.TrimSpace(form.Params)
     taskModel.Timeout = form.Timeout
     taskModel.Tag = form.Tag
     taskModel.Remark = form.Remark
-    taskModel.Multi = form.Multi
+    taskModel.OverlapPolicy = form.OverlapPolicy
+    taskModel.MaxInstances = form.MaxInstances
     taskModel.RetryTimes = form.RetryTimes
-    if taskModel.Multi != 1 {
-        taskModel.Multi = 0
+    // 兼容旧版本, 多实例运行且不限制实例数时Multi为1
+    taskModel.Multi = 0
+    if taskModel.OverlapPolicy != models.TaskOverlapParallel {
+        taskModel.MaxInstances = 0
+    } else if taskModel.MaxInstances < 0 || taskModel.MaxInstances > 1000 {
+        return json.CommonFailure("最大实例数取值0-1000")
+    } else if taskModel.MaxInstances == 0 {
+        taskModel.Multi = 1
     }
     taskModel.NotifyStatus = form.NotifyStatus - 1
     taskModel.NotifyType = form.NotifyType - 1
     taskModel.NotifyReceiverId = form.NotifyReceiverId
     taskModel.Spec = form.Spec
     taskModel.Level = form.Level
-    taskModel.DependencyStatus = form.DependencyStatus
-    taskModel.DependencyTaskId = strings.TrimSpace(form.DependencyTaskId)
+    taskModel.TriggerRule = form.TriggerRule
     if taskModel.NotifyStatus > 0 && taskModel.NotifyReceiverId == "" {
         return json.CommonFailure("至少选择一个通知接收者")
     }
@@ -154,34 +221,138 @@ func Store(ctx *macaron.Context, form TaskForm) string  {
         if !strings.HasPrefix(command, "http://") && !strings.HasPrefix(command, "https://") {
             return json.CommonFailure("请输入正确的URL地址")
         }
-        if taskModel.Timeout > 300 {
+        // 提交后轮询时超时时间为整个执行过程的超时时间
+        if taskModel.Timeout > 300 && form.HttpAsync != models.TaskHttpPoll {
             return json.CommonFailure("HTTP任务超时时间不能超过300秒")
         }
+        message := setHttpConfig(&taskModel, form)
+        if message != "" {
+            return json.CommonFailure(message)
+        }
+    } else {
+        setHttpConfig(&taskModel, TaskForm{})
+    }
+
+    _, err = taskModel.ParamMap()
+    if err != nil {
+        return json.CommonFailure(err.Error())
     }
 
     if taskModel.RetryTimes > 10 || taskModel.RetryTimes < 0 {
         return json.CommonFailure("任务重试次数取值0-10")
     }
+    taskModel.RetryPolicy = form.RetryPolicy
+    taskModel.RetryInterval = form.RetryInterval
+    taskModel.RetryMaxInterval = form.RetryMaxInterval
+    taskModel.RetryJitter = form.RetryJitter
+    if taskModel.RetryMaxInterval > 0 && taskModel.RetryMaxInterval < taskModel.RetryInterval {
+        return json.CommonFailure("重试间隔上限不能小于重试间隔")
+    }
+    taskModel.RetryOn, err = parseIntList(form.RetryOn, 1, 6)
+    if err != nil {
+        return json.CommonFailure("重试错误类型参数错误", err)
+    }
+    taskModel.RetryExitCodes, err = parseIntList(form.RetryExitCodes, 1, 255)
+    if err != nil {
+        return json.CommonFailure("重试退出码格式错误, 取值1-255, 多个逗号分隔", err)
+    }
+    if len(taskModel.RetryExitCodes) > 128 {
+        return json.CommonFailure("重试退出码过多")
+    }
 
-    if (taskModel.DependencyStatus != models.TaskDependencyStatusStrong &&
-        taskModel.DependencyStatus != models.TaskDependencyStatusWeak) {
-        return json.CommonFailure("请选择依赖关系")
+    taskModel.MisfirePolicy = form.MisfirePolicy
+    taskModel.MisfireLimit = form.MisfireLimit
+    if taskModel.MisfirePolicy != models.TaskMisfireRunAll {
+        taskModel.MisfireLimit = 0
+    } else if taskModel.MisfireLimit < 1 || taskModel.MisfireLimit > 100 {
+        return json.CommonFailure("补偿执行次数上限取值1-100")
     }
 
+    taskModel.Jitter = form.Jitter
+    taskModel.JitterMode = form.JitterMode
+
+    taskModel.Timezone = strings.TrimSpace(form.Timezone)
+    taskModel.CalendarIds, err = parseCalendarIds(form.CalendarIds)
+    if err != nil {
+        return json.CommonFailure("日历参数错误", err)
+    }
+    taskModel.ScheduleType = models.TaskScheduleCrontab
     if taskModel.Level == models.TaskLevelParent {
-        _, err = cron.Parse(form.Spec)
+        location, err := service.LoadLocation(taskModel.Timezone)
         if err != nil {
-            return json.CommonFailure("crontab表达式解析失败", err)
+            return json.CommonFailure("时区无效, 请输入IANA时区名称, 如Asia/Shanghai", err)
+        }
+        if form.ScheduleType == models.TaskScheduleOnce {
+            taskModel.ScheduleType = models.TaskScheduleOnce
+            taskModel.Spec = ""
+            taskModel.RunAt, err = time.ParseInLocation(models.DefaultTimeFormat, strings.TrimSpace(form.RunAt), location)
+            if err != nil {
+                return json.CommonFailure("执行时间格式错误, 格式为2006-01-02 15:04:05")
+            }
+            // 已执行过的任务修改其他配置时不校验执行时间
+            if isEnabledOrNew(id) && !taskModel.RunAt.After(time.Now()) {
+                return json.CommonFailure("执行时间必须晚于当前时间")
+            }
+            // 错过的执行时间由调度器在启动后直接执行
+            taskModel.MisfirePolicy = models.TaskMisfireIgnore
+            taskModel.MisfireLimit = 0
+        } else {
+            _, err = cron.Parse(form.Spec)
+            if err != nil {
+                return json.CommonFailure("crontab表达式解析失败", err)
+            }
         }
+        taskModel.TriggerRule = models.TaskTriggerAllDone
     } else {
-        taskModel.DependencyTaskId = ""
         taskModel.Spec = ""
+        taskModel.Timezone = ""
+        taskModel.CalendarIds = ""
+        taskModel.Jitter = 0
+        taskModel.MisfirePolicy = models.TaskMisfireIgnore
+        taskModel.MisfireLimit = 0
     }
 
-    if id > 0 && taskModel.DependencyTaskId != "" {
-        dependencyTaskIds := strings.Split(taskModel.DependencyTaskId, ",")
-        if utils.InStringSlice(dependencyTaskIds, strconv.Itoa(id)) {
-            return json.CommonFailure("不允许设置当前任务为子任务")
+    taskModel.SlaDuration = form.SlaDuration
+    taskModel.SlaDeadline = strings.TrimSpace(form.SlaDeadline)
+    // 最晚成功时间每天检查, 只适用于按crontab调度的主任务
+    if taskModel.Level == models.TaskLevelChild || taskModel.IsOnce() {
+        taskModel.SlaDeadline = ""
+    }
+    if taskModel.SlaDeadline != "" {
+        hour, minute, err := service.ParseSlaDeadline(taskModel.SlaDeadline)
+        if err != nil {
+            return json.CommonFailure(err.Error())
+        }
+        taskModel.SlaDeadline = fmt.Sprintf("%02d:%02d", hour, minute)
+    }
+    if (taskModel.SlaDuration > 0 || taskModel.SlaDeadline != "") && (taskModel.NotifyType <= 0 || taskModel.NotifyReceiverId == "") {
+        return json.CommonFailure("设置SLA预警需选择通知类型和通知接收者")
+    }
+
+    taskModel.FailureHookIds, err = parseHookIds(id, form.FailureHookIds)
+    if err != nil {
+        return json.CommonFailure("失败处理任务参数错误", err)
+    }
+    taskModel.SuccessHookIds, err = parseHookIds(id, form.SuccessHookIds)
+    if err != nil {
+        return json.CommonFailure("成功处理任务参数错误", err)
+    }
+
+    var dependencies []models.TaskDependency
+    if taskModel.Level == models.TaskLevelChild {
+        if taskModel.TriggerRule != models.TaskTriggerAllDone && taskModel.TriggerRule != models.TaskTriggerAnyDone {
+            return json.CommonFailure("请选择触发条件")
+        }
+        dependencies, err = parseDependencies(form.Dependencies)
+        if err != nil {
+            return json.CommonFailure("上游任务参数错误", err)
+        }
+        if len(dependencies) == 0 {
+            return json.CommonFailure("请设置上游任务")
+        }
+        message := checkDependencies(id, dependencies)
+        if message != "" {
+            return json.CommonFailure(message)
         }
     }
 
@@ -209,6 +380,13 @@ func Store(ctx *macaron.Context, form TaskForm) string  {
         taskHostModel.Remove(id)
     }
 
+    // 主任务没有上游任务, 子任务修改为主任务时删除原有的上游依赖
+    dependencyModel := new(models.TaskDependency)
+    err = dependencyModel.Save(id, dependencies)
+    if err != nil {
+        return json.CommonFailure("保存上游任务失败", err)
+    }
+
     status, err := taskModel.GetStatus(id)
     if status == models.Enabled && taskModel.Level == models.TaskLevelParent {
         addTaskToTimer(id)
@@ -221,22 +399,40 @@ func Store(ctx *macaron.Context, form TaskForm) string  {
 func Remove(ctx *macaron.Context) string {
     id  := ctx.ParamsInt(":id")
     json := utils.JsonResponse{}
+    dependencyModel := new(models.TaskDependency)
+    hasDownstream, err := dependencyModel.HasDownstream(id)
+    if err != nil {
+        return json.CommonFailure(utils.FailureContent, err)
+    }
+    if hasDownstream {
+        return json.CommonFailure("有下游任务依赖此任务，不能删除")
+    }
     taskModel := new(models.Task)
-    _, err := taskModel.Delete(id)
+    _, err = taskModel.Delete(id)
     if err != nil {
         return json.CommonFailure(utils.FailureContent, err)
     }
 
     taskHostModel := new(models.TaskHost)
     taskHostModel.Remove(id)
+    dependencyModel.Remove(id)
 
-    service.Cron.RemoveJob(strconv.Itoa(id))
+    serviceTask := new(service.Task)
+    serviceTask.Remove(id)
 
     return json.Success(utils.SuccessContent, nil)
 }
 
 // 激活任务
 func Enable(ctx *macaron.Context) string {
+    id := ctx.ParamsInt(":id")
+    taskModel := new(models.Task)
+    task, err := taskModel.Detail(id)
+    if err == nil && task.IsOnce() && !task.RunAt.After(time.Now()) {
+        json := utils.JsonResponse{}
+        return json.CommonFailure("单次执行任务的执行时间已过, 请修改执行时间后再激活")
+    }
+
     return changeStatus(ctx, models.Enabled)
 }
 
@@ -257,11 +453,81 @@ func Run(ctx *macaron.Context) string {
 
     task.Spec = "手动运行"
     serviceTask := new(service.Task)
-    serviceTask.Run(task)
+    serviceTask.Run(task, parseRunParams(ctx))
 
     return json.Success("任务已开始运行, 请到任务日志中查看结果", nil);
 }
 
+type BackfillForm struct {
+    StartDate string `binding:"Required"`
+    EndDate string `binding:"Required"`
+    Concurrency int `binding:"Range(1,10)"`
+}
+
+func (f BackfillForm) Error(ctx *macaron.Context, errs binding.Errors) {
+    if len(errs) == 0 {
+        return
+    }
+    json := utils.JsonResponse{}
+    content := json.CommonFailure("表单验证失败, 请检测输入")
+
+    ctx.Resp.Write([]byte(content))
+}
+
+// 回填执行, 按crontab表达式执行日期范围内(包含结束日期当天)的所有时间点
+func Backfill(ctx *macaron.Context, form BackfillForm) string {
+    id := ctx.ParamsInt(":id")
+    json := utils.JsonResponse{}
+    taskModel := new(models.Task)
+    task, err := taskModel.Detail(id)
+    if err != nil || task.Id <= 0 {
+        return json.CommonFailure("获取任务详情失败", err)
+    }
+    location, err := service.LoadLocation(task.Timezone)
+    if err != nil {
+        return json.CommonFailure("任务时区无效", err)
+    }
+    startDate, err := time.ParseInLocation(models.CalendarDateFormat, strings.TrimSpace(form.StartDate), location)
+    if err != nil {
+        return json.CommonFailure("开始日期格式错误, 格式为2006-01-02")
+    }
+    endDate, err := time.ParseInLocation(models.CalendarDateFormat, strings.TrimSpace(form.EndDate), location)
+    if err != nil {
+        return json.CommonFailure("结束日期格式错误, 格式为2006-01-02")
+    }
+    if endDate.Before(startDate) {
+        return json.CommonFailure("结束日期不能早于开始日期")
+    }
+    endTime := endDate.AddDate(0, 0, 1)
+    if endTime.After(time.Now()) {
+        endTime = time.Now()
+    }
+
+    serviceTask := new(service.Task)
+    times, err := serviceTask.Backfill(task, startDate, endTime, form.Concurrency, parseRunParams(ctx))
+    if err != nil {
+        return json.CommonFailure(err.Error())
+    }
+    if times == 0 {
+        return json.CommonFailure("日期范围内没有需要执行的时间点")
+    }
+
+    return json.Success(fmt.Sprintf("回填执行已开始, 共%d次, 请到任务日志中查看结果", times), nil)
+}
+
+// 解析运行参数, 参数param.参数名覆盖任务参数默认值
+func parseRunParams(ctx *macaron.Context) map[string]string {
+    params := make(map[string]string)
+    ctx.Req.ParseForm()
+    for key, values := range ctx.Req.Form {
+        if strings.HasPrefix(key, "param.") && len(values) > 0 {
+            params[strings.TrimPrefix(key, "param.")] = values[0]
+        }
+    }
+
+    return params
+}
+
 // 改变任务状态
 func changeStatus(ctx *macaron.Context, status models.Status) string {
     id  := ctx.ParamsInt(":id")
@@ -277,12 +543,178 @@ func changeStatus(ctx *macaron.Context, status models.Status) string {
     if status == models.Enabled {
         addTaskToTimer(id)
     } else {
-        service.Cron.RemoveJob(strconv.Itoa(id))
+        serviceTask := new(service.Task)
+        serviceTask.Remove(id)
     }
 
     return json.Success(utils.SuccessContent, nil)
 }
 
+// 设置HTTP请求配置, 校验失败返回错误信息
+func setHttpConfig(taskModel *models.Task, form TaskForm) string {
+    taskModel.HttpMethod = strings.ToUpper(strings.TrimSpace(form.HttpMethod))
+    if taskModel.HttpMethod == "" {
+        taskModel.HttpMethod = "GET"
+    }
+    if !utils.InStringSlice(models.TaskHttpMethods, taskModel.HttpMethod) {
+        return "不支持的请求方法-" + taskModel.HttpMethod
+    }
+    taskModel.HttpHeaders = strings.TrimSpace(form.HttpHeaders)
+    taskModel.HttpQuery = strings.TrimSpace(form.HttpQuery)
+    taskModel.HttpBodyType = form.HttpBodyType
+    taskModel.HttpBody = strings.TrimSpace(form.HttpBody)
+    if taskModel.HttpBodyType == models.TaskHttpBodyNone {
+        taskModel.HttpBody = ""
+    }
+    taskModel.HttpAuthType = form.HttpAuthType
+    taskModel.HttpAuthUser = strings.TrimSpace(form.HttpAuthUser)
+    taskModel.HttpAuthSecret = strings.TrimSpace(form.HttpAuthSecret)
+    // 编辑页面不回显密码/Token和客户端私钥, 未填写时保留原值
+    var storedAuthSecret, storedClientKey string
+    if form.Id > 0 && (form.HttpAuthSecret == "" || form.HttpClientKey == "") {
+        var err error
+        storedAuthSecret, storedClientKey, err = new(models.Task).HttpSecrets(form.Id)
+        if err != nil {
+            logger.Error("获取任务HTTP认证信息失败#", err)
+            return utils.FailureContent
+        }
+    }
+    if taskModel.HttpAuthSecret == "" {
+        taskModel.HttpAuthSecret = storedAuthSecret
+    }
+    switch taskModel.HttpAuthType {
+    case models.TaskHttpAuthNone:
+        taskModel.HttpAuthUser = ""
+        taskModel.HttpAuthSecret = ""
+    case models.TaskHttpAuthBasic:
+        if taskModel.HttpAuthUser == "" {
+            return "请输入Basic认证用户名"
+        }
+    case models.TaskHttpAuthBearer:
+        taskModel.HttpAuthUser = ""
+        if taskModel.HttpAuthSecret == "" {
+            return "请输入Bearer Token"
+        }
+    }
+
+    var err error
+    taskModel.HttpSuccessCodes, err = parseHttpSuccessCodes(form.HttpSuccessCodes)
+    if err != nil {
+        return err.Error()
+    }
+    taskModel.HttpBodyMatchType = form.HttpBodyMatchType
+    taskModel.HttpBodyMatch = form.HttpBodyMatch
+    if taskModel.HttpBodyMatchType == models.TaskHttpMatchNone {
+        taskModel.HttpBodyMatch = ""
+    } else if taskModel.HttpBodyMatch == "" {
+        return "请输入响应内容需包含的字符串或正则表达式"
+    }
+    taskModel.HttpJsonAssertions = strings.TrimSpace(form.HttpJsonAssertions)
+    taskModel.HttpMaxLatency = form.HttpMaxLatency
+    if err = service.CheckHttpAssertions(*taskModel); err != nil {
+        return err.Error()
+    }
+    taskModel.HttpAsync = form.HttpAsync
+    taskModel.CallbackTimeout = form.CallbackTimeout
+    if taskModel.CallbackTimeout <= 0 {
+        taskModel.CallbackTimeout = service.DefaultCallbackTimeout
+    }
+    if taskModel.HttpAsync == models.TaskHttpCallback && strings.TrimSpace(app.Setting.CallbackUrl) == "" {
+        return "异步执行需在配置文件中设置回调地址callback.url"
+    }
+    taskModel.HttpJobIdPath = ""
+    taskModel.HttpPollUrl = ""
+    taskModel.HttpPollInterval = form.HttpPollInterval
+    if taskModel.HttpPollInterval <= 0 {
+        taskModel.HttpPollInterval = service.DefaultPollInterval
+    }
+    taskModel.HttpPollSuccess = ""
+    taskModel.HttpPollFailure = ""
+    if taskModel.HttpAsync == models.TaskHttpPoll {
+        if form.Timeout <= 0 {
+            return "提交后轮询需设置任务超时时间"
+        }
+        taskModel.HttpJobIdPath = strings.TrimSpace(form.HttpJobIdPath)
+        taskModel.HttpPollUrl = strings.TrimSpace(form.HttpPollUrl)
+        taskModel.HttpPollSuccess = strings.TrimSpace(form.HttpPollSuccess)
+        taskModel.HttpPollFailure = strings.TrimSpace(form.HttpPollFailure)
+        if err = service.CheckHttpPoll(*taskModel); err != nil {
+            return err.Error()
+        }
+    }
+
+    taskModel.HttpCaCert = strings.TrimSpace(form.HttpCaCert)
+    taskModel.HttpClientCert = strings.TrimSpace(form.HttpClientCert)
+    taskModel.HttpClientKey = strings.TrimSpace(form.HttpClientKey)
+    if taskModel.HttpClientKey == "" && taskModel.HttpClientCert != "" {
+        taskModel.HttpClientKey = storedClientKey
+    }
+    if (taskModel.HttpClientCert == "") != (taskModel.HttpClientKey == "") {
+        return "客户端证书和私钥需同时设置"
+    }
+    taskModel.HttpInsecureSkipVerify = form.HttpInsecureSkipVerify
+    taskModel.HttpProxy = strings.TrimSpace(form.HttpProxy)
+    taskModel.HttpRedirect = form.HttpRedirect
+    if err = service.CheckHttpOptions(*taskModel); err != nil {
+        return err.Error()
+    }
+
+    if _, err := taskModel.HttpHeaderList(); err != nil {
+        return err.Error()
+    }
+    if _, err := taskModel.HttpQueryList(); err != nil {
+        return err.Error()
+    }
+    if taskModel.HttpBodyType == models.TaskHttpBodyForm {
+        if _, err := taskModel.HttpFormList(); err != nil {
+            return err.Error()
+        }
+    }
+
+    return ""
+}
+
+// 校验并格式化成功状态码, 多个逗号分隔, 支持范围如200-299
+func parseHttpSuccessCodes(value string) (string, error) {
+    items := make([]string, 0)
+    for _, item := range strings.Split(value, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+        bounds := strings.SplitN(item, "-", 2)
+        codes := make([]string, len(bounds))
+        for i, bound := range bounds {
+            code, err := strconv.Atoi(strings.TrimSpace(bound))
+            if err != nil || code < 100 || code > 599 {
+                return "", errors.New("无效的HTTP状态码-" + item)
+            }
+            codes[i] = strconv.Itoa(code)
+        }
+        if len(codes) == 2 && codes[0] > codes[1] {
+            return "", errors.New("无效的HTTP状态码范围-" + item)
+        }
+        items = append(items, strings.Join(codes, "-"))
+    }
+    result := strings.Join(items, ",")
+    if len(result) > 128 {
+        return "", errors.New("成功状态码过多")
+    }
+
+    return result, nil
+}
+
+// 新增任务或任务处于激活状态
+func isEnabledOrNew(id int) bool {
+    if id == 0 {
+        return true
+    }
+    taskModel := new(models.Task)
+    status, err := taskModel.GetStatus(id)
+
+    return err != nil || status == models.Enabled
+}
+
 // 添加任务到定时器
 func addTaskToTimer(id int)  {
     taskModel := new(models.Task)
@@ -324,6 +756,168 @@ func setHostsToTemplate(ctx *macaron.Context)  {
     ctx.Data["Hosts"] = hosts
 }
 
+func setCalendarsToTemplate(ctx *macaron.Context, calendarIds string)  {
+    calendarModel := new(models.Calendar)
+    calendars, err := calendarModel.AllList()
+    if err != nil {
+        logger.Error(err)
+    }
+    selectedIds := strings.Split(calendarIds, ",")
+    for i, calendar := range calendars {
+        calendars[i].Selected = utils.InStringSlice(selectedIds, strconv.Itoa(calendar.Id))
+    }
+    ctx.Data["Calendars"] = calendars
+}
+
+// 校验并格式化日历ID, 多个ID逗号分隔
+func parseCalendarIds(calendarIds string) (string, error) {
+    ids := make([]string, 0)
+    for _, idStr := range strings.Split(calendarIds, ",") {
+        idStr = strings.TrimSpace(idStr)
+        if idStr == "" {
+            continue
+        }
+        id, err := strconv.Atoi(idStr)
+        if err != nil || id <= 0 {
+            return "", errors.New("无效的日历ID-" + idStr)
+        }
+        ids = append(ids, strconv.Itoa(id))
+    }
+    result := strings.Join(ids, ",")
+    if len(result) > 64 {
+        return "", errors.New("引用的日历过多")
+    }
+
+    return result, nil
+}
+
+// 解析上游任务, 格式为 任务ID:依赖关系, 多个逗号分隔
+func parseDependencies(value string) ([]models.TaskDependency, error) {
+    dependencies := make([]models.TaskDependency, 0)
+    upstreamIds := make(map[int]bool)
+    for _, item := range strings.Split(value, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+        pair := strings.Split(item, ":")
+        if len(pair) != 2 {
+            return nil, errors.New("格式错误-" + item)
+        }
+        upstreamId, err := strconv.Atoi(strings.TrimSpace(pair[0]))
+        if err != nil || upstreamId <= 0 {
+            return nil, errors.New("无效的任务ID-" + pair[0])
+        }
+        status, err := strconv.Atoi(strings.TrimSpace(pair[1]))
+        if err != nil || (status != int(models.TaskDependencyStatusStrong) && status != int(models.TaskDependencyStatusWeak)) {
+            return nil, errors.New("无效的依赖关系-" + pair[1])
+        }
+        if upstreamIds[upstreamId] {
+            return nil, errors.New("上游任务重复-" + pair[0])
+        }
+        upstreamIds[upstreamId] = true
+        dependencies = append(dependencies, models.TaskDependency{
+            UpstreamTaskId: upstreamId,
+            Status: models.TaskDependencyStatus(status),
+        })
+    }
+
+    return dependencies, nil
+}
+
+// 校验上游任务是否存在、是否形成循环依赖, 校验失败返回错误信息
+func checkDependencies(id int, dependencies []models.TaskDependency) string {
+    taskModel := new(models.Task)
+    upstreamIds := make([]int, len(dependencies))
+    for i, item := range dependencies {
+        if item.UpstreamTaskId == id {
+            return "不允许设置当前任务为上游任务"
+        }
+        task, err := taskModel.Detail(item.UpstreamTaskId)
+        if err != nil || task.Id <= 0 {
+            return fmt.Sprintf("上游任务不存在-%d", item.UpstreamTaskId)
+        }
+        upstreamIds[i] = item.UpstreamTaskId
+    }
+    dependencyModel := new(models.TaskDependency)
+    allDependencies, err := dependencyModel.AllList()
+    if err != nil {
+        return "获取任务依赖关系失败"
+    }
+    // 新增的任务没有下游任务, 不会形成环
+    if id > 0 {
+        cycle := service.DependencyCycle(allDependencies, id, upstreamIds)
+        if cycle != nil {
+            return "存在循环依赖: " + joinTaskIds(cycle, " -> ")
+        }
+    }
+    fanInTaskId, rootIds := service.DependencyMultiRoot(allDependencies, id, upstreamIds)
+    if len(rootIds) > 0 {
+        taskName := fmt.Sprintf("任务%d", fanInTaskId)
+        if fanInTaskId == id {
+            taskName = "当前任务"
+        }
+        return fmt.Sprintf("%s的上游任务来自多个根任务(%s), 各根任务独立调度, 无法等待所有上游任务, 请将上游任务设置为同一根任务的下游任务",
+            taskName, joinTaskIds(rootIds, ","))
+    }
+
+    return ""
+}
+
+func joinTaskIds(taskIds []int, separator string) string {
+    ids := make([]string, len(taskIds))
+    for i, taskId := range taskIds {
+        ids[i] = strconv.Itoa(taskId)
+    }
+
+    return strings.Join(ids, separator)
+}
+
+// 校验并格式化处理任务ID, 多个ID逗号分隔
+func parseHookIds(id int, value string) (string, error) {
+    result, err := parseIntList(value, 1, math.MaxInt32)
+    if err != nil {
+        return "", err
+    }
+    if len(result) > 64 {
+        return "", errors.New("处理任务过多")
+    }
+    if result == "" {
+        return "", nil
+    }
+    taskModel := new(models.Task)
+    for _, idStr := range strings.Split(result, ",") {
+        hookId, _ := strconv.Atoi(idStr)
+        if hookId == id {
+            return "", errors.New("不允许设置当前任务为处理任务")
+        }
+        task, err := taskModel.Detail(hookId)
+        if err != nil || task.Id <= 0 {
+            return "", errors.New("任务不存在-" + idStr)
+        }
+    }
+
+    return result, nil
+}
+
+// 校验并格式化逗号分隔的整数列表
+func parseIntList(value string, min, max int) (string, error) {
+    items := make([]string, 0)
+    for _, item := range strings.Split(value, ",") {
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+        number, err := strconv.Atoi(item)
+        if err != nil || number < min || number > max {
+            return "", errors.New("无效的取值-" + item)
+        }
+        items = append(items, strconv.Itoa(number))
+    }
+
+    return strings.Join(items, ","), nil
+}
+
 func inHosts(slice []models.TaskHostDetail, element int16) bool {
     for _, v := range slice {
         if v.HostId == element {
@@ -11,6 +11,7 @@ import (
     "fmt"
     "html/template"
     "gocron/routers/base"
+    "gocron/service"
 )
 
 func Index(ctx *macaron.Context)  {
@@ -24,9 +25,15 @@ func Index(ctx *macaron.Context)  {
     if err != nil {
         logger.Error(err)
     }
-    PageParams := fmt.Sprintf("task_id=%d&protocol=%d&status=%d&page_size=%d",
+    positions := service.QueuePositions()
+    for i, item := range logs {
+        if item.Status == models.Waiting {
+            logs[i].QueuePosition = positions[item.Id]
+        }
+    }
+    PageParams := fmt.Sprintf("task_id=%d&protocol=%d&status=%d&workflow_run_id=%d&page_size=%d",
         queryParams["TaskId"], queryParams["Protocol"], queryParams["Status"],
-        queryParams["PageSize"]);
+        queryParams["WorkflowRunId"], queryParams["PageSize"]);
     queryParams["PageParams"] = template.URL(PageParams)
     p := paginater.New(int(total), queryParams["PageSize"].(int), queryParams["Page"].(int), 5)
     ctx.Data["Pagination"] = p
@@ -64,6 +71,19 @@ func Remove(ctx *macaron.Context) string {
     return json.Success("删除成功", nil)
 }
 
+// 获取每次执行(含重试)的记录
+func Attempts(ctx *macaron.Context) string {
+    id := ctx.ParamsInt64(":id")
+    attemptModel := new(models.TaskLogAttempt)
+    attempts, err := attemptModel.List(id)
+    json := utils.JsonResponse{}
+    if err != nil {
+        return json.CommonFailure("获取执行记录失败", err)
+    }
+
+    return json.Success("", attempts)
+}
+
 // 解析查询参数
 func parseQueryParams(ctx *macaron.Context) (models.CommonMap) {
     var params models.CommonMap = models.CommonMap{}
@@ -74,6 +94,7 @@ func parseQueryParams(ctx *macaron.Context) (models.CommonMap) {
         status -= 1
     }
     params["Status"] = status
+    params["WorkflowRunId"] = ctx.QueryInt64("workflow_run_id")
     base.ParsePageAndPageSize(ctx, params)
 
     return params
@@ -0,0 +1,98 @@
+package workflow
+
+// 工作流运行记录
+
+import (
+	"fmt"
+	"html/template"
+
+	"gocron/models"
+	"gocron/modules/logger"
+	"gocron/modules/utils"
+	"gocron/routers/base"
+	"gocron/service"
+
+	"github.com/Unknwon/paginater"
+	"gopkg.in/macaron.v1"
+)
+
+func Index(ctx *macaron.Context) {
+	runModel := new(models.WorkflowRun)
+	queryParams := parseQueryParams(ctx)
+	total, err := runModel.Total(queryParams)
+	if err != nil {
+		logger.Error(err)
+	}
+	runs, err := runModel.List(queryParams)
+	if err != nil {
+		logger.Error(err)
+	}
+	PageParams := fmt.Sprintf("task_id=%d&status=%d&page_size=%d",
+		queryParams["TaskId"], queryParams["Status"], queryParams["PageSize"])
+	queryParams["PageParams"] = template.URL(PageParams)
+	p := paginater.New(int(total), queryParams["PageSize"].(int), queryParams["Page"].(int), 5)
+	ctx.Data["Pagination"] = p
+	ctx.Data["Title"] = "工作流运行记录"
+	ctx.Data["Runs"] = runs
+	ctx.Data["Params"] = queryParams
+	ctx.HTML(200, "task/workflow")
+}
+
+// 运行详情, 展示运行树
+func Detail(ctx *macaron.Context) {
+	run, nodes, err := detail(ctx.ParamsInt64(":id"))
+	if err != nil {
+		logger.Error(err)
+	}
+	ctx.Data["Title"] = "工作流运行详情"
+	ctx.Data["Run"] = run
+	ctx.Data["Nodes"] = nodes
+	ctx.HTML(200, "task/workflow_detail")
+}
+
+// 运行详情API, 返回运行记录及运行树中的任务
+func Nodes(ctx *macaron.Context) string {
+	json := utils.JsonResponse{}
+	run, nodes, err := detail(ctx.ParamsInt64(":id"))
+	if err != nil {
+		return json.CommonFailure("获取工作流运行记录失败", err)
+	}
+	if run.Id <= 0 {
+		return json.CommonFailure("工作流运行记录不存在")
+	}
+
+	return json.Success("", map[string]interface{}{
+		"Run":   run,
+		"Nodes": nodes,
+	})
+}
+
+func detail(id int64) (models.WorkflowRun, []service.WorkflowNode, error) {
+	runModel := new(models.WorkflowRun)
+	run, err := runModel.Detail(id)
+	if err != nil || run.Id <= 0 {
+		return run, nil, err
+	}
+	taskLogModel := new(models.TaskLog)
+	logs, err := taskLogModel.ListByWorkflowRunId(run.Id)
+	if err != nil {
+		return run, nil, err
+	}
+	nodes, err := service.WorkflowNodes(run, logs)
+
+	return run, nodes, err
+}
+
+// 解析查询参数
+func parseQueryParams(ctx *macaron.Context) models.CommonMap {
+	var params models.CommonMap = models.CommonMap{}
+	params["TaskId"] = ctx.QueryInt("task_id")
+	status := ctx.QueryInt("status")
+	if status >= 0 {
+		status -= 1
+	}
+	params["Status"] = status
+	base.ParsePageAndPageSize(ctx, params)
+
+	return params
+}
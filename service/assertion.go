@@ -0,0 +1,232 @@
+package service
+
+// HTTP任务响应断言
+// 依次检查状态码、响应时间、响应内容、JSON断言, 任一不满足即视为执行失败
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/httpclient"
+)
+
+// 响应断言失败
+type httpAssertionError string
+
+func (e httpAssertionError) Error() string {
+	return "响应断言失败-" + string(e)
+}
+
+// 检查HTTP响应是否满足任务设置的成功条件
+func checkHttpResponse(taskModel models.Task, resp httpclient.ResponseWrapper, latency time.Duration) error {
+	// 未收到响应
+	if resp.StatusCode == 0 {
+		return httpStatusError(0)
+	}
+	if !taskModel.AcceptHttpStatus(resp.StatusCode) {
+		return httpStatusError(resp.StatusCode)
+	}
+	if taskModel.HttpMaxLatency > 0 && latency > time.Duration(taskModel.HttpMaxLatency)*time.Millisecond {
+		return httpAssertionError(fmt.Sprintf("响应时间%dms超过%dms", latency/time.Millisecond, taskModel.HttpMaxLatency))
+	}
+	switch taskModel.HttpBodyMatchType {
+	case models.TaskHttpMatchContains:
+		if !strings.Contains(resp.Body, taskModel.HttpBodyMatch) {
+			return httpAssertionError("响应内容不包含" + taskModel.HttpBodyMatch)
+		}
+	case models.TaskHttpMatchRegex:
+		pattern, err := regexp.Compile(taskModel.HttpBodyMatch)
+		if err != nil {
+			return httpAssertionError("正则表达式错误-" + err.Error())
+		}
+		if !pattern.MatchString(resp.Body) {
+			return httpAssertionError("响应内容不匹配正则表达式" + taskModel.HttpBodyMatch)
+		}
+	}
+	assertions, err := taskModel.HttpJsonAssertionList()
+	if err != nil {
+		return httpAssertionError(err.Error())
+	}
+	if len(assertions) == 0 {
+		return nil
+	}
+	document, err := decodeJSON(resp.Body)
+	if err != nil {
+		return httpAssertionError("响应内容不是有效的JSON")
+	}
+	for _, item := range assertions {
+		err = assertJSON(document, item.Key, item.Value)
+		if err != nil {
+			return httpAssertionError(err.Error())
+		}
+	}
+
+	return nil
+}
+
+// 校验任务的响应断言配置
+func CheckHttpAssertions(taskModel models.Task) error {
+	if taskModel.HttpBodyMatchType == models.TaskHttpMatchRegex {
+		_, err := regexp.Compile(taskModel.HttpBodyMatch)
+		if err != nil {
+			return errors.New("响应内容正则表达式错误-" + err.Error())
+		}
+	}
+	assertions, err := taskModel.HttpJsonAssertionList()
+	if err != nil {
+		return err
+	}
+	for _, item := range assertions {
+		_, err = parseJSONPath(item.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeJSON(text string) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+
+	return value, err
+}
+
+// JSONPath取值与期望值比较, 期望值不是有效的JSON时按字符串比较
+func assertJSON(document interface{}, path string, expected string) error {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return err
+	}
+	actual, ok := lookupJSON(document, segments)
+	if !ok {
+		return fmt.Errorf("%s不存在", path)
+	}
+	expectedValue, err := decodeJSON(expected)
+	if err != nil {
+		expectedValue = expected
+	}
+	if !jsonEqual(actual, expectedValue) {
+		return fmt.Errorf("%s期望%s, 实际%s", path, expected, formatJSON(actual))
+	}
+
+	return nil
+}
+
+// JSONPath中的一级, 对象属性或数组下标
+type jsonPathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// 解析JSONPath, 支持 $.a.b、$.a[0]、$['a.b']
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	invalid := errors.New("JSONPath格式错误-" + path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid
+	}
+	segments := make([]jsonPathSegment, 0)
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, invalid
+			}
+			segments = append(segments, jsonPathSegment{key: key})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			quote := rest[1:2]
+			end := strings.Index(rest[2:], quote+"]")
+			if end < 0 {
+				return nil, invalid
+			}
+			segments = append(segments, jsonPathSegment{key: rest[2 : end+2]})
+			rest = rest[end+4:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, invalid
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, invalid
+			}
+			segments = append(segments, jsonPathSegment{index: index, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, invalid
+		}
+	}
+
+	return segments, nil
+}
+
+func lookupJSON(value interface{}, segments []jsonPathSegment) (interface{}, bool) {
+	for _, segment := range segments {
+		if segment.isIndex {
+			list, ok := value.([]interface{})
+			if !ok || segment.index >= len(list) {
+				return nil, false
+			}
+			value = list[segment.index]
+			continue
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = object[segment.key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// 数字按数值比较, 其他按JSON编码后比较
+func jsonEqual(actual interface{}, expected interface{}) bool {
+	actualNumber, ok1 := actual.(json.Number)
+	expectedNumber, ok2 := expected.(json.Number)
+	if ok1 && ok2 {
+		a, err1 := actualNumber.Float64()
+		b, err2 := expectedNumber.Float64()
+		if err1 == nil && err2 == nil {
+			return a == b
+		}
+	}
+
+	return formatJSON(actual) == formatJSON(expected)
+}
+
+func formatJSON(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return strings.TrimSpace(buf.String())
+}
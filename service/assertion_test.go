@@ -0,0 +1,94 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/httpclient"
+)
+
+func TestCheckHttpResponseStatus(t *testing.T) {
+	taskModel := models.Task{}
+	// 未设置成功状态码时只接受200
+	if err := checkHttpResponse(taskModel, httpclient.ResponseWrapper{StatusCode: 204}, 0); err != httpStatusError(204) {
+		t.Fatalf("期望状态码错误, 实际%v", err)
+	}
+	taskModel.HttpSuccessCodes = "200-204,302"
+	for _, code := range []int{200, 201, 204, 302} {
+		if err := checkHttpResponse(taskModel, httpclient.ResponseWrapper{StatusCode: code}, 0); err != nil {
+			t.Fatalf("状态码%d应视为成功-%v", code, err)
+		}
+	}
+	if err := checkHttpResponse(taskModel, httpclient.ResponseWrapper{StatusCode: 301}, 0); err != httpStatusError(301) {
+		t.Fatalf("期望状态码错误, 实际%v", err)
+	}
+	// 未收到响应
+	if err := checkHttpResponse(taskModel, httpclient.ResponseWrapper{}, 0); err != httpStatusError(0) {
+		t.Fatalf("期望请求失败, 实际%v", err)
+	}
+}
+
+func TestCheckHttpResponseAssertions(t *testing.T) {
+	resp := httpclient.ResponseWrapper{
+		StatusCode: 200,
+		Body:       `{"ok": false, "data": {"count": 10, "items": [{"status": "success"}], "a.b": null}}`,
+	}
+	tests := []struct {
+		taskModel models.Task
+		reason    string // 为空时期望成功
+	}{
+		{models.Task{HttpMaxLatency: 100}, "响应时间200ms超过100ms"},
+		{models.Task{HttpBodyMatchType: models.TaskHttpMatchContains, HttpBodyMatch: `"items"`}, ""},
+		{models.Task{HttpBodyMatchType: models.TaskHttpMatchContains, HttpBodyMatch: "error"}, "响应内容不包含error"},
+		{models.Task{HttpBodyMatchType: models.TaskHttpMatchRegex, HttpBodyMatch: `"count":\s*\d+`}, ""},
+		{models.Task{HttpJsonAssertions: "$.ok == true"}, "$.ok期望true, 实际false"},
+		{models.Task{HttpJsonAssertions: "$.ok == false\n$.data.count == 10.0\n$.data.items[0].status == success\n$['data']['a.b'] == null"}, ""},
+		{models.Task{HttpJsonAssertions: `$.data.items[0].status == "failed"`}, `$.data.items[0].status期望"failed", 实际success`},
+		{models.Task{HttpJsonAssertions: "$.data.items[1].status == success"}, "$.data.items[1].status不存在"},
+	}
+	for i, test := range tests {
+		err := checkHttpResponse(test.taskModel, resp, 200*time.Millisecond)
+		if test.reason == "" {
+			if err != nil {
+				t.Fatalf("第%d个断言应成功-%v", i, err)
+			}
+			continue
+		}
+		if _, ok := err.(httpAssertionError); !ok || !strings.HasSuffix(err.Error(), test.reason) {
+			t.Fatalf("第%d个断言失败原因不匹配, 期望%s, 实际%v", i, test.reason, err)
+		}
+	}
+
+	_, err := decodeJSON("not json")
+	if err == nil {
+		t.Fatal("无效的JSON应解析失败")
+	}
+	err = checkHttpResponse(models.Task{HttpJsonAssertions: "$.ok == true"}, httpclient.ResponseWrapper{StatusCode: 200, Body: "ok"}, 0)
+	if err == nil {
+		t.Fatal("响应内容不是JSON时JSON断言应失败")
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	segments, err := parseJSONPath(`$.data["a.b"][2].c`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []jsonPathSegment{{key: "data"}, {key: "a.b"}, {index: 2, isIndex: true}, {key: "c"}}
+	if len(segments) != len(expected) {
+		t.Fatalf("解析结果不匹配-%v", segments)
+	}
+	for i := range expected {
+		if segments[i] != expected[i] {
+			t.Fatalf("解析结果不匹配-%v", segments)
+		}
+	}
+	for _, path := range []string{"data.a", "$..a", "$.a[", "$.a[-1]", "$['a"} {
+		_, err = parseJSONPath(path)
+		if err == nil {
+			t.Fatalf("应解析失败-%s", path)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package service
+
+// 异步HTTP任务
+// 请求时附带一次性回调地址和token, 请求成功后任务日志状态变为等待回调, 远程服务执行结束后POST回调地址提交最终状态和输出
+// 回调地址、token通过请求头X-Gocron-Callback-Url、X-Gocron-Callback-Token传递, 也可在URL、请求体等模板中使用{{.Run.CallbackUrl}}、{{.Run.CallbackToken}}
+// 超过回调超时时间未回调, 本次执行失败
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"gocron/models"
+	"gocron/modules/app"
+	"gocron/modules/httpclient"
+	"gocron/modules/logger"
+)
+
+const (
+	CallbackUrlHeader   = "X-Gocron-Callback-Url"
+	CallbackTokenHeader = "X-Gocron-Callback-Token"
+)
+
+// 默认等待回调超时时间(单位秒)
+const DefaultCallbackTimeout = 3600
+
+// 回调可能由其他调度器实例接收, 定时查询回调记录
+const callbackPollInterval = 5 * time.Second
+
+// 回调提交的输出最大长度, 超出部分截断
+const maxCallbackOutputSize = 1024 * 1024
+
+var (
+	errCallbackTimeout     = errors.New("等待回调超时")
+	errCallbackUrlNotSet   = errors.New("未配置回调地址callback.url, 无法执行异步HTTP任务")
+	errRemoteTaskFailure   = errors.New("远程任务执行失败")
+	errCallbackUnavailable = errors.New("回调地址已失效")
+)
+
+// 本实例等待中的回调, 收到回调后立即通知
+var callbackWaiters = callbackRegistry{waiters: make(map[int64]chan struct{})}
+
+type callbackRegistry struct {
+	sync.Mutex
+	waiters map[int64]chan struct{}
+}
+
+func (r *callbackRegistry) add(id int64) chan struct{} {
+	r.Lock()
+	defer r.Unlock()
+	wait := make(chan struct{}, 1)
+	r.waiters[id] = wait
+
+	return wait
+}
+
+func (r *callbackRegistry) remove(id int64) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.waiters, id)
+}
+
+func (r *callbackRegistry) notify(id int64) {
+	r.Lock()
+	defer r.Unlock()
+	wait, ok := r.waiters[id]
+	if !ok {
+		return
+	}
+	select {
+	case wait <- struct{}{}:
+	default:
+	}
+}
+
+// 执行异步HTTP任务
+func runAsyncHttp(ctx context.Context, taskModel models.Task, vars commandVars) (string, error) {
+	baseUrl := strings.TrimRight(strings.TrimSpace(app.Setting.CallbackUrl), "/")
+	if baseUrl == "" {
+		return "", errCallbackUrlNotSet
+	}
+	timeout := taskModel.CallbackTimeout
+	if timeout <= 0 {
+		timeout = DefaultCallbackTimeout
+	}
+	token, err := newCallbackToken()
+	if err != nil {
+		return "", err
+	}
+	callbackModel := new(models.TaskCallback)
+	callbackModel.TaskLogId = vars.Run.LogId
+	callbackModel.Token = hashCallbackToken(token)
+	callbackModel.Status = models.Running
+	callbackModel.ExpiredAt = time.Now().Add(time.Duration(timeout) * time.Second)
+	callbackId, err := callbackModel.Create()
+	if err != nil {
+		return "", err
+	}
+	wait := callbackWaiters.add(callbackId)
+	defer callbackWaiters.remove(callbackId)
+
+	vars.Run.CallbackUrl = callbackUrl(baseUrl, callbackId)
+	vars.Run.CallbackToken = token
+	request, err := newHttpRequest(taskModel, vars)
+	if err != nil {
+		expireCallback(callbackId)
+		return "", err
+	}
+	request.Header.Set(CallbackUrlHeader, vars.Run.CallbackUrl)
+	request.Header.Set(CallbackTokenHeader, token)
+	startTime := time.Now()
+	resp := httpclient.Do(ctx, request)
+	if resp.Timeout {
+		expireCallback(callbackId)
+		return resp.Body, errHTTPTimeout
+	}
+	err = checkHttpResponse(taskModel, resp, time.Since(startTime))
+	if err != nil {
+		expireCallback(callbackId)
+		if resp.StatusCode > 0 {
+			return resp.Body + "\n\n" + err.Error(), err
+		}
+		return resp.Body, err
+	}
+
+	taskLogModel := new(models.TaskLog)
+	_, err = taskLogModel.StartAsync(vars.Run.LogId)
+	if err != nil {
+		logger.Errorf("异步HTTP任务#更新任务日志状态失败#日志ID-%d#%s", vars.Run.LogId, err.Error())
+	}
+
+	return waitCallback(ctx, callbackId, time.Duration(timeout)*time.Second, wait)
+}
+
+// 等待回调, 超时或任务被停止时回调地址失效
+func waitCallback(ctx context.Context, callbackId int64, timeout time.Duration, wait chan struct{}) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(callbackPollInterval)
+	defer ticker.Stop()
+	callbackModel := new(models.TaskCallback)
+	for {
+		select {
+		case <-wait:
+		case <-ticker.C:
+		case <-timer.C:
+			if expireCallback(callbackId) {
+				return "", errCallbackTimeout
+			}
+		case <-ctx.Done():
+			if expireCallback(callbackId) {
+				return "", ctx.Err()
+			}
+		}
+		callback, err := callbackModel.Detail(callbackId)
+		if err != nil {
+			logger.Errorf("异步HTTP任务#查询回调记录失败#回调ID-%d#%s", callbackId, err.Error())
+			continue
+		}
+		result, done, err := callbackResult(callback)
+		if done {
+			return result, err
+		}
+	}
+}
+
+// 回调结果, 等待回调时done为false
+func callbackResult(callback models.TaskCallback) (result string, done bool, err error) {
+	switch callback.Status {
+	case models.Running:
+		return "", false, nil
+	case models.Finish:
+		return callback.Result, true, nil
+	case models.Failure:
+		return callback.Result, true, errRemoteTaskFailure
+	}
+
+	return callback.Result, true, errCallbackUnavailable
+}
+
+// 回调地址失效, 已回调返回false
+func expireCallback(callbackId int64) bool {
+	callbackModel := new(models.TaskCallback)
+	expired, err := callbackModel.Expire(callbackId)
+	if err != nil {
+		logger.Errorf("异步HTTP任务#回调地址失效失败#回调ID-%d#%s", callbackId, err.Error())
+		return true
+	}
+
+	return expired
+}
+
+// CompleteCallback 远程服务提交执行结果, 回调地址无效、已过期或已使用返回false
+func CompleteCallback(callbackId int64, token string, success bool, output string) (bool, error) {
+	if callbackId <= 0 || token == "" {
+		return false, nil
+	}
+	status := models.Failure
+	if success {
+		status = models.Finish
+	}
+	callbackModel := new(models.TaskCallback)
+	ok, err := callbackModel.Complete(callbackId, hashCallbackToken(token), status, truncateString(output, maxCallbackOutputSize))
+	if err != nil || !ok {
+		return ok, err
+	}
+	callbackWaiters.notify(callbackId)
+
+	return true, nil
+}
+
+func callbackUrl(baseUrl string, callbackId int64) string {
+	return fmt.Sprintf("%s/api/callback/%d", baseUrl, callbackId)
+}
+
+func newCallbackToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// 数据库中只保存token摘要
+func hashCallbackToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+
+	"gocron/models"
+)
+
+func TestCallbackToken(t *testing.T) {
+	token, err := newCallbackToken()
+	if err != nil || len(token) != 32 {
+		t.Fatalf("生成token错误-%s-%v", token, err)
+	}
+	other, _ := newCallbackToken()
+	if token == other {
+		t.Fatal("token不应重复")
+	}
+	hash := hashCallbackToken(token)
+	if len(hash) != 64 || hash == token || hash != hashCallbackToken(token) {
+		t.Fatalf("token摘要错误-%s", hash)
+	}
+	if url := callbackUrl("http://gocron.example.com:5920", 12); url != "http://gocron.example.com:5920/api/callback/12" {
+		t.Fatalf("回调地址错误-%s", url)
+	}
+}
+
+func TestCallbackRegistry(t *testing.T) {
+	registry := callbackRegistry{waiters: make(map[int64]chan struct{})}
+	wait := registry.add(1)
+	registry.notify(1)
+	// 重复通知不阻塞
+	registry.notify(1)
+	registry.notify(2)
+	select {
+	case <-wait:
+	default:
+		t.Fatal("未收到回调通知")
+	}
+	registry.remove(1)
+	registry.notify(1)
+	select {
+	case <-wait:
+		t.Fatal("移除后不应收到通知")
+	default:
+	}
+}
+
+func TestCallbackResult(t *testing.T) {
+	tests := []struct {
+		status models.Status
+		done   bool
+		err    error
+	}{
+		{models.Running, false, nil},
+		{models.Finish, true, nil},
+		{models.Failure, true, errRemoteTaskFailure},
+		{models.Cancel, true, errCallbackUnavailable},
+	}
+	for _, test := range tests {
+		result, done, err := callbackResult(models.TaskCallback{Status: test.status, Result: "output"})
+		if done != test.done || err != test.err {
+			t.Fatalf("状态%d期望%v-%v, 实际%v-%v", test.status, test.done, test.err, done, err)
+		}
+		if done && result != "output" {
+			t.Fatalf("状态%d输出错误-%s", test.status, result)
+		}
+	}
+	if !isTimeout(errCallbackTimeout) {
+		t.Fatal("等待回调超时应视为超时")
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+// 回填执行
+// 按crontab表达式计算历史时间范围内的执行时间点, 以时间点作为计划执行时间执行, 命令中可通过{{.Run.ScheduledTime}}等变量获取
+// 回填执行不受任务重叠执行策略限制, 同时执行数由回填并发数控制
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+	"gocron/modules/scheduler"
+)
+
+// 单次回填最多执行次数
+const maxBackfillTimes = 1000
+
+// 单次回填最大并发数
+const MaxBackfillConcurrency = 10
+
+// 回填执行[start, end)之间的执行时间点, 返回执行次数
+func (task *Task) Backfill(taskModel models.Task, start, end time.Time, concurrency int, params map[string]string) (int, error) {
+	if taskModel.Level != models.TaskLevelParent {
+		return 0, errors.New("子任务不支持回填执行")
+	}
+	if taskModel.IsOnce() {
+		return 0, errors.New("单次执行任务不支持回填执行")
+	}
+	if !start.Before(end) {
+		return 0, errors.New("开始时间必须早于结束时间")
+	}
+	if concurrency < 1 || concurrency > MaxBackfillConcurrency {
+		return 0, fmt.Errorf("并发数取值1-%d", MaxBackfillConcurrency)
+	}
+	schedule, err := parseSchedule(taskModel)
+	if err != nil {
+		return 0, err
+	}
+	times, err := calcBackfillTimes(schedule, start, end)
+	if err != nil {
+		return 0, err
+	}
+	if len(times) == 0 {
+		return 0, nil
+	}
+	handler := createHandler(taskModel)
+	if handler == nil {
+		return 0, errors.New("不支持的任务协议")
+	}
+	logger.Infof("回填执行#任务ID-%d#执行次数-%d#并发数-%d", taskModel.Id, len(times), concurrency)
+	go runBackfill(handler, taskModel, times, concurrency, params)
+
+	return len(times), nil
+}
+
+// 计算[start, end)之间的执行时间点
+func calcBackfillTimes(schedule scheduler.Schedule, start, end time.Time) ([]time.Time, error) {
+	times := make([]time.Time, 0)
+	next := schedule.Next(start.Add(-time.Second))
+	for !next.IsZero() && next.Before(end) {
+		if len(times) >= maxBackfillTimes {
+			return nil, fmt.Errorf("执行次数超过%d次, 请缩小时间范围", maxBackfillTimes)
+		}
+		times = append(times, next)
+		next = schedule.Next(next)
+	}
+
+	return times, nil
+}
+
+// 按时间顺序分配给concurrency个执行者执行
+func runBackfill(handler Handler, taskModel models.Task, times []time.Time, concurrency int, params map[string]string) {
+	taskModel.OverlapPolicy = models.TaskOverlapParallel
+	taskModel.MaxInstances = 0
+	queue := make(chan time.Time)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for scheduledTime := range queue {
+				runContext := RunContext{
+					Type:          models.TaskTypeBackfill,
+					ScheduledTime: scheduledTime,
+					Params:        params,
+				}
+				if skipByCalendar(taskModel, runContext) {
+					continue
+				}
+				runWorkflow(handler, taskModel, runContext)
+			}
+		}()
+	}
+	for _, scheduledTime := range times {
+		select {
+		case queue <- scheduledTime:
+		case <-taskContext.Done():
+			// 应用退出, 不再执行剩余时间点
+			logger.Warnf("回填执行#应用退出, 剩余时间点不再执行#任务ID-%d", taskModel.Id)
+			close(queue)
+			wg.Wait()
+			return
+		}
+	}
+	close(queue)
+	wg.Wait()
+	logger.Infof("回填执行完成#任务ID-%d", taskModel.Id)
+}
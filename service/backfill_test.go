@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gocron/models"
+)
+
+func TestCalcBackfillTimes(t *testing.T) {
+	location, _ := time.LoadLocation("Asia/Shanghai")
+	schedule, err := parseSchedule(models.Task{Spec: "0 0 2 * * *", Timezone: "Asia/Shanghai"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2017-06-06(周二)至2017-06-09(周五)
+	start := time.Date(2017, 6, 6, 0, 0, 0, 0, location)
+	end := time.Date(2017, 6, 10, 0, 0, 0, 0, location)
+	times, err := calcBackfillTimes(schedule, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 4 {
+		t.Fatalf("期望4个执行时间点, 实际%v", times)
+	}
+	for i, item := range times {
+		expected := time.Date(2017, 6, 6+i, 2, 0, 0, 0, location)
+		if !item.Equal(expected) {
+			t.Fatalf("期望%s, 实际%s", expected, item)
+		}
+	}
+
+	// 开始时间恰好为执行时间点时包含在内
+	schedule, _ = parseSchedule(models.Task{Spec: "0 0 0 * * *", Timezone: "Asia/Shanghai"})
+	times, _ = calcBackfillTimes(schedule, start, end)
+	if len(times) != 4 || !times[0].Equal(start) {
+		t.Fatalf("应包含开始时间, 实际%v", times)
+	}
+
+	schedule, _ = parseSchedule(models.Task{Spec: "* * * * * *"})
+	_, err = calcBackfillTimes(schedule, start, start.Add(time.Hour))
+	if err == nil {
+		t.Fatal("执行次数超过上限应返回错误")
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+)
+
+const skippedByCalendarMessage = "skipped by calendar"
+
+// 计划执行日期被任务引用的日历排除时, 写入跳过日志并返回true
+func skipByCalendar(taskModel models.Task, runContext RunContext) bool {
+	excluded, date, name := excludedByCalendar(taskModel, runContext.ScheduledTime)
+	if !excluded {
+		return false
+	}
+
+	result := skippedByCalendarMessage
+	if name != "" {
+		result += ": " + name
+	}
+	logger.Infof("任务执行日期被日历排除, 跳过执行#任务ID-%d#日期-%s#%s", taskModel.Id, date, name)
+	createSkippedLog(taskModel, runContext, result)
+
+	return true
+}
+
+// 日期被任务引用的日历排除时返回true, 日期按任务时区计算, 查询日历失败时不排除
+func excludedByCalendar(taskModel models.Task, t time.Time) (excluded bool, date string, name string) {
+	if strings.TrimSpace(taskModel.CalendarIds) == "" {
+		return
+	}
+	location, err := LoadLocation(taskModel.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+	date = t.In(location).Format(models.CalendarDateFormat)
+	calendarDateModel := new(models.CalendarDate)
+	dates, err := calendarDateModel.Match(taskModel.CalendarIds, date)
+	if err != nil {
+		logger.Errorf("查询任务日历失败#任务ID-%d#%s", taskModel.Id, err.Error())
+		return
+	}
+	excluded, name = calendarExcluded(dates)
+
+	return
+}
+
+// 写入跳过执行的任务日志
+func createSkippedLog(taskModel models.Task, runContext RunContext, result string) int64 {
+	taskLogId, err := createTaskLog(taskModel, models.Skipped, runContext)
+	if err != nil {
+		logger.Error("任务跳过执行#写入任务日志失败-", err)
+		return 0
+	}
+	taskLogModel := new(models.TaskLog)
+	_, err = taskLogModel.Update(taskLogId, models.CommonMap{"result": result})
+	if err != nil {
+		logger.Error("任务跳过执行#更新任务日志失败-", err)
+	}
+
+	return taskLogId
+}
+
+// 日期被排除且未被任何日历包含时返回true和排除日期的名称
+func calendarExcluded(dates []models.CalendarDate) (bool, string) {
+	excluded := false
+	name := ""
+	for _, item := range dates {
+		if item.Type == models.CalendarDateInclude {
+			return false, ""
+		}
+		if item.Type == models.CalendarDateExclude && !excluded {
+			excluded = true
+			name = item.Name
+		}
+	}
+
+	return excluded, name
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+
+	"gocron/models"
+)
+
+func TestCalendarExcluded(t *testing.T) {
+	holiday := models.CalendarDate{Type: models.CalendarDateExclude, Name: "国庆节"}
+	workday := models.CalendarDate{Type: models.CalendarDateInclude, Name: "调休"}
+	tests := []struct {
+		dates    []models.CalendarDate
+		excluded bool
+		name     string
+	}{
+		{nil, false, ""},
+		{[]models.CalendarDate{holiday}, true, "国庆节"},
+		{[]models.CalendarDate{workday}, false, ""},
+		// 包含优先于排除
+		{[]models.CalendarDate{holiday, workday}, false, ""},
+	}
+	for i, test := range tests {
+		excluded, name := calendarExcluded(test.dates)
+		if excluded != test.excluded || name != test.name {
+			t.Errorf("#%d 期望%v-%s, 实际%v-%s", i, test.excluded, test.name, excluded, name)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+// 命令模板
+// shell命令、HTTP URL及请求配置中可使用Go模板语法引用变量, 每次执行(含重试)前渲染, 如
+// {{.Run.ScheduledTime | addDays -1 | date "2006-01-02"}} 计划执行时间的前一天, 重试时不变
+// {{.Run.TaskId}}、{{.Run.LogId}}、{{.Run.Attempt}}、{{.Run.HostAlias}} 本次执行信息
+// {{.Run.CallbackUrl}}、{{.Run.CallbackToken}} 异步HTTP任务回调地址和token
+// {{.Run.JobId}} 提交后轮询的HTTP任务, 提交请求返回的任务ID
+// {{.Params.变量名}} 任务参数, 未设置时使用默认值
+// {{.LogId}}、{{.Outputs.变量名}} 上游任务信息, 子任务和处理任务可用
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+)
+
+// 命令模板中可使用的变量
+type commandVars struct {
+	upstreamContext
+	Run    runVars
+	Params map[string]string
+}
+
+// 本次执行信息
+type runVars struct {
+	TaskId        int
+	TaskName      string
+	LogId         int64
+	Attempt       int       // 第几次执行, 从1开始
+	HostAlias     string    // 执行命令的主机别名, HTTP任务为空
+	HostName      string    // 执行命令的主机名, HTTP任务为空
+	ScheduledTime time.Time // 计划执行时间, 使用任务时区
+	Date          string    // 计划执行日期, 格式2006-01-02
+	Yesterday     string    // 计划执行日期的前一天, 格式2006-01-02
+	CallbackUrl   string    // 异步HTTP任务回调地址, 其他任务为空
+	CallbackToken string    // 异步HTTP任务回调token, 其他任务为空
+	JobId         string    // 提交后轮询的HTTP任务, 提交请求返回的任务ID, 其他任务为空
+}
+
+var commandFuncs = template.FuncMap{
+	// 按Go时间格式格式化, 如 date "20060102"
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"addDays": func(days int, t time.Time) time.Time {
+		return t.AddDate(0, 0, days)
+	},
+	"addHours": func(hours int, t time.Time) time.Time {
+		return t.Add(time.Duration(hours) * time.Hour)
+	},
+	// 未设置或为空时使用默认值, 如 {{.Params.date | default .Run.Yesterday}}
+	"default": func(value string, s string) string {
+		if s == "" {
+			return value
+		}
+		return s
+	},
+}
+
+func newCommandVars(taskModel models.Task, runContext RunContext, taskLogId int64, attempt int) commandVars {
+	scheduledTime := runContext.ScheduledTime
+	if scheduledTime.IsZero() {
+		scheduledTime = time.Now().Truncate(time.Second)
+	}
+	// 子任务和处理任务按根任务时区计算, 与根任务日期一致
+	location := runContext.Location
+	if location == nil {
+		location, _ = LoadLocation(taskModel.Timezone)
+	}
+	if location != nil {
+		scheduledTime = scheduledTime.In(location)
+	}
+	params, _ := taskModel.ParamMap()
+	for key, value := range runContext.Params {
+		params[key] = value
+	}
+
+	return commandVars{
+		upstreamContext: runContext.Upstream,
+		Run: runVars{
+			TaskId:        taskModel.Id,
+			TaskName:      taskModel.Name,
+			LogId:         taskLogId,
+			Attempt:       attempt,
+			ScheduledTime: scheduledTime,
+			Date:          scheduledTime.Format("2006-01-02"),
+			Yesterday:     scheduledTime.AddDate(0, 0, -1).Format("2006-01-02"),
+		},
+		Params: params,
+	}
+}
+
+// 在指定主机上执行
+func (v commandVars) forHost(host models.TaskHostDetail) commandVars {
+	v.Run.HostAlias = host.Alias
+	v.Run.HostName = host.Name
+
+	return v
+}
+
+// 是否存在上游任务信息
+func (v commandVars) hasUpstream() bool {
+	return len(v.Upstreams) > 0
+}
+
+func (v commandVars) render(command string) (string, error) {
+	if !strings.Contains(command, "{{") {
+		return command, nil
+	}
+	tpl, err := template.New("command").Funcs(commandFuncs).Option("missingkey=zero").Parse(command)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, v)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// 渲染任务命令
+func renderCommand(taskModel models.Task, vars commandVars) string {
+	return renderTemplate(taskModel, vars, taskModel.Command)
+}
+
+// 渲染失败时使用原文本, 兼容文本中本身包含{{的情况, 如docker --format
+func renderTemplate(taskModel models.Task, vars commandVars, text string) string {
+	result, err := vars.render(text)
+	if err != nil {
+		logger.Warnf("渲染任务模板失败, 使用原文本#任务ID-%d#%s", taskModel.Id, err.Error())
+		return text
+	}
+
+	return result
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gocron/models"
+)
+
+func TestCommandVars(t *testing.T) {
+	taskModel := models.Task{
+		Id:       5,
+		Name:     "export",
+		Timezone: "Asia/Shanghai",
+		Params:   "# 导出目录\ndir=/data/export\ndate=\n",
+	}
+	// 计划执行时间为北京时间2017-06-01 00:00:00, 服务器时区为UTC时仍按任务时区计算
+	scheduledTime := time.Date(2017, 5, 31, 16, 0, 0, 0, time.UTC)
+	runContext := RunContext{ScheduledTime: scheduledTime, Params: map[string]string{"dir": "/tmp"}}
+	vars := newCommandVars(taskModel, runContext, 100, 2)
+
+	command, err := vars.render(`export.sh {{.Run.TaskId}} {{.Run.LogId}} {{.Run.Attempt}} {{.Run.Yesterday}} {{.Run.ScheduledTime | addDays -1 | date "20060102"}} {{.Params.date | default .Run.Date}} {{.Params.dir}} {{.Params.missing}}`)
+	expected := "export.sh 5 100 2 2017-05-31 20170531 2017-06-01 /tmp "
+	if err != nil || command != expected {
+		t.Fatalf("期望%s, 实际%s-%v", expected, command, err)
+	}
+
+	vars = vars.forHost(models.TaskHostDetail{Alias: "web1", Name: "192.168.1.1"})
+	command, _ = vars.render("echo {{.Run.HostAlias}}-{{.Run.HostName}}")
+	if command != "echo web1-192.168.1.1" {
+		t.Fatalf("主机变量渲染错误-%s", command)
+	}
+	if vars.hasUpstream() {
+		t.Fatal("没有上游任务信息")
+	}
+}
+
+// 子任务未设置时区, 按根任务时区计算日期
+func TestCommandVarsChildTask(t *testing.T) {
+	location, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("加载时区失败-%s", err)
+	}
+	taskModel := models.Task{Id: 6, Level: models.TaskLevelChild}
+	scheduledTime := time.Date(2017, 5, 31, 16, 0, 0, 0, time.UTC)
+	runContext := RunContext{ScheduledTime: scheduledTime, WorkflowRunId: 1, Location: location}
+	vars := newCommandVars(taskModel, runContext, 101, 1)
+
+	command, err := vars.render("{{.Run.Date}} {{.Run.Yesterday}}")
+	if err != nil || command != "2017-06-01 2017-05-31" {
+		t.Fatalf("子任务应按根任务时区计算日期, 实际%s-%v", command, err)
+	}
+}
+
+func TestRenderCommandFallback(t *testing.T) {
+	taskModel := models.Task{Command: "docker ps --format '{{.Names}}'"}
+	vars := newCommandVars(taskModel, RunContext{}, 1, 1)
+	if _, err := vars.render(taskModel.Command); err == nil {
+		t.Fatal("引用不存在的变量应返回错误")
+	}
+	if _, err := vars.render("echo {{.Run.TaskId"); err == nil {
+		t.Fatal("模板格式错误应返回错误")
+	}
+}
+
+func TestTaskParamMap(t *testing.T) {
+	params, err := models.Task{Params: "a=1\n\n b = x=y \n"}.ParamMap()
+	if err != nil || len(params) != 2 || params["a"] != "1" || params["b"] != "x=y" {
+		t.Fatalf("参数解析错误-%v-%v", params, err)
+	}
+	if _, err := (models.Task{Params: "1a=1"}).ParamMap(); err == nil {
+		t.Fatal("参数名格式错误应返回错误")
+	}
+	if _, err := (models.Task{Params: "abc"}).ParamMap(); err == nil {
+		t.Fatal("缺少=应返回错误")
+	}
+}
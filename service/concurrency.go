@@ -0,0 +1,315 @@
+package service
+
+// 任务并发数限制
+// 支持全局、按任务标签、按任务节点限制同时执行的任务数, 超过限制的任务排队等待
+// 受同一限制约束的任务按排队先后顺序执行, 不受约束的任务不会被阻塞
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/app"
+	"gocron/modules/logger"
+
+	"golang.org/x/net/context"
+)
+
+// 并发数限制, 0不限制
+type concurrencyLimits struct {
+	global int
+	tags   map[string]int
+	hosts  map[int16]int
+}
+
+// 等待执行的任务
+type waiter struct {
+	taskModel models.Task
+	taskLogId int64
+	ready     chan struct{}
+}
+
+type runQueue struct {
+	limits  concurrencyLimits
+	global  int
+	tags    map[string]int
+	hosts   map[int16]int
+	waiters *list.List
+	sync.Mutex
+}
+
+var taskQueue = newRunQueue()
+
+func newRunQueue() *runQueue {
+	return &runQueue{
+		limits: concurrencyLimits{
+			tags:  make(map[string]int),
+			hosts: make(map[int16]int),
+		},
+		tags:    make(map[string]int),
+		hosts:   make(map[int16]int),
+		waiters: list.New(),
+	}
+}
+
+// 从数据库重新加载并发数限制
+func (task *Task) ReloadConcurrencyLimits() {
+	err := loadConcurrencyLimits()
+	if err != nil {
+		logger.Error("加载任务并发数限制失败", err)
+	}
+	// 主节点重新加载
+	if !IsLeader() {
+		notifyLeader()
+	}
+}
+
+func loadConcurrencyLimits() error {
+	settingModel := new(models.Setting)
+	concurrency, err := settingModel.Concurrency()
+	if err != nil {
+		return err
+	}
+	hostModel := new(models.Host)
+	hostLimits, err := hostModel.ConcurrencyLimits()
+	if err != nil {
+		return err
+	}
+	limits := concurrencyLimits{
+		global: concurrency.Global,
+		tags:   make(map[string]int),
+		hosts:  hostLimits,
+	}
+	for _, item := range concurrency.Tags {
+		limits.tags[item.Tag] = item.Limit
+	}
+	taskQueue.setLimits(limits)
+
+	return nil
+}
+
+func (q *runQueue) setLimits(limits concurrencyLimits) {
+	q.Lock()
+	defer q.Unlock()
+	q.limits = limits
+	// 限制可能已放宽
+	q.dispatch()
+}
+
+// 未超过并发数限制且没有受同一限制约束的任务在排队时占用执行名额, 返回true
+func (q *runQueue) tryAcquire(taskModel models.Task) bool {
+	q.Lock()
+	defer q.Unlock()
+	if !q.fits(taskModel) {
+		return false
+	}
+	for element := q.waiters.Front(); element != nil; element = element.Next() {
+		if q.conflicts(element.Value.(*waiter).taskModel, taskModel) {
+			return false
+		}
+	}
+	q.take(taskModel)
+
+	return true
+}
+
+// 排队等待执行名额, ctx取消时返回错误
+func (q *runQueue) wait(ctx context.Context, taskModel models.Task, taskLogId int64) error {
+	q.Lock()
+	w := &waiter{taskModel: taskModel, taskLogId: taskLogId, ready: make(chan struct{})}
+	element := q.waiters.PushBack(w)
+	// 入队前可能已有任务结束
+	q.dispatch()
+	q.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		q.Lock()
+		defer q.Unlock()
+		select {
+		case <-w.ready:
+			// 已获得执行名额, 归还
+			q.giveBack(taskModel)
+			q.dispatch()
+		default:
+			q.waiters.Remove(element)
+		}
+		return ctx.Err()
+	}
+}
+
+// 排队位置, key为任务日志id, 位置从1开始
+// 只计算排在前面且受同一并发数限制约束的任务
+func (q *runQueue) positions() map[int64]int {
+	q.Lock()
+	defer q.Unlock()
+	positions := make(map[int64]int, q.waiters.Len())
+	for element := q.waiters.Front(); element != nil; element = element.Next() {
+		w := element.Value.(*waiter)
+		position := 1
+		for prev := q.waiters.Front(); prev != element; prev = prev.Next() {
+			if q.conflicts(prev.Value.(*waiter).taskModel, w.taskModel) {
+				position++
+			}
+		}
+		positions[w.taskLogId] = position
+	}
+
+	return positions
+}
+
+// 排队中任务的排队位置, key为任务日志id
+// 排队队列只在执行任务的调度器实例内存中, 主备模式下备节点及等待上次执行结束的任务不返回排队位置
+func QueuePositions() map[int64]int {
+	return taskQueue.positions()
+}
+
+// 释放执行名额, 唤醒排队中的任务
+func (q *runQueue) release(taskModel models.Task) {
+	q.Lock()
+	defer q.Unlock()
+	q.giveBack(taskModel)
+	q.dispatch()
+}
+
+// 按排队顺序唤醒未超过限制的任务, 不越过排在前面且受同一限制约束的任务
+func (q *runQueue) dispatch() {
+	blocked := make([]models.Task, 0)
+	for element := q.waiters.Front(); element != nil; {
+		next := element.Next()
+		w := element.Value.(*waiter)
+		if q.fits(w.taskModel) && !q.conflictsAny(blocked, w.taskModel) {
+			q.take(w.taskModel)
+			q.waiters.Remove(element)
+			close(w.ready)
+		} else {
+			blocked = append(blocked, w.taskModel)
+		}
+		element = next
+	}
+}
+
+func (q *runQueue) conflictsAny(tasks []models.Task, taskModel models.Task) bool {
+	for _, item := range tasks {
+		if q.conflicts(item, taskModel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 两个任务是否受同一并发数限制约束
+func (q *runQueue) conflicts(a, b models.Task) bool {
+	if q.limits.global > 0 {
+		return true
+	}
+	if a.Tag != "" && a.Tag == b.Tag && q.limits.tags[a.Tag] > 0 {
+		return true
+	}
+	for _, hostId := range taskHostIds(a) {
+		if q.limits.hosts[hostId] <= 0 {
+			continue
+		}
+		for _, otherHostId := range taskHostIds(b) {
+			if hostId == otherHostId {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (q *runQueue) fits(taskModel models.Task) bool {
+	if q.limits.global > 0 && q.global >= q.limits.global {
+		return false
+	}
+	if limit := q.limits.tags[taskModel.Tag]; taskModel.Tag != "" && limit > 0 && q.tags[taskModel.Tag] >= limit {
+		return false
+	}
+	for _, hostId := range taskHostIds(taskModel) {
+		if limit := q.limits.hosts[hostId]; limit > 0 && q.hosts[hostId] >= limit {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (q *runQueue) take(taskModel models.Task) {
+	q.global++
+	if taskModel.Tag != "" {
+		q.tags[taskModel.Tag]++
+	}
+	for _, hostId := range taskHostIds(taskModel) {
+		q.hosts[hostId]++
+	}
+}
+
+func (q *runQueue) giveBack(taskModel models.Task) {
+	q.global--
+	if taskModel.Tag != "" {
+		q.tags[taskModel.Tag]--
+		if q.tags[taskModel.Tag] <= 0 {
+			delete(q.tags, taskModel.Tag)
+		}
+	}
+	for _, hostId := range taskHostIds(taskModel) {
+		q.hosts[hostId]--
+		if q.hosts[hostId] <= 0 {
+			delete(q.hosts, hostId)
+		}
+	}
+}
+
+// HTTP任务不占用节点名额
+func taskHostIds(taskModel models.Task) []int16 {
+	if taskModel.Protocol != models.TaskRPC {
+		return nil
+	}
+	hostIds := make([]int16, len(taskModel.Hosts))
+	for i, host := range taskModel.Hosts {
+		hostIds[i] = host.HostId
+	}
+
+	return hostIds
+}
+
+// 排队等待上次执行结束和并发数限制, 获得执行名额后更新任务日志为执行中
+// 主备模式下调度执行时校验租约, 排队期间已失去主节点身份时返回errLeaseLost
+func waitInQueue(slot *instanceSlot, taskModel models.Task, taskLogId int64, leaseToken int64) error {
+	start := time.Now()
+	if slot.pending {
+		logger.Infof("上次执行未结束, 任务排队等待#任务ID-%d#日志ID-%d", taskModel.Id, taskLogId)
+		err := runInstance.waitStart(taskModel.Id, slot)
+		if err != nil {
+			return err
+		}
+	}
+	err := taskQueue.wait(slot.ctx, taskModel, taskLogId)
+	if err != nil {
+		return err
+	}
+	taskLogModel := new(models.TaskLog)
+	waitTime := int(time.Since(start).Seconds())
+	if leaseToken > 0 {
+		held, err := taskLogModel.StartWaitingWithLease(taskLogId, waitTime, models.LeaseScheduler, app.InstanceId, leaseToken)
+		if err != nil {
+			logger.Error("任务排队结束#更新任务日志失败-", err)
+		} else if !held {
+			taskQueue.release(taskModel)
+			return errLeaseLost
+		}
+		return nil
+	}
+	_, err = taskLogModel.StartWaiting(taskLogId, waitTime)
+	if err != nil {
+		logger.Error("任务排队结束#更新任务日志失败-", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gocron/models"
+
+	"golang.org/x/net/context"
+)
+
+func newTestRunQueue(limits concurrencyLimits) *runQueue {
+	q := newRunQueue()
+	if limits.tags == nil {
+		limits.tags = make(map[string]int)
+	}
+	if limits.hosts == nil {
+		limits.hosts = make(map[int16]int)
+	}
+	q.setLimits(limits)
+
+	return q
+}
+
+func rpcTask(id int, tag string, hostIds ...int16) models.Task {
+	taskModel := models.Task{Id: id, Tag: tag, Protocol: models.TaskRPC}
+	for _, hostId := range hostIds {
+		taskModel.Hosts = append(taskModel.Hosts, models.TaskHostDetail{TaskHost: models.TaskHost{HostId: hostId}})
+	}
+
+	return taskModel
+}
+
+// 等待并返回获得执行名额的顺序
+func waitAsync(q *runQueue, taskModel models.Task, started chan<- int) {
+	go func() {
+		if q.wait(context.Background(), taskModel, int64(taskModel.Id)) == nil {
+			started <- taskModel.Id
+		}
+	}()
+	// 保证入队顺序
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestRunQueueGlobalLimit(t *testing.T) {
+	q := newTestRunQueue(concurrencyLimits{global: 1})
+	first := rpcTask(1, "")
+	if !q.tryAcquire(first) {
+		t.Fatal("未超过限制应直接执行")
+	}
+	if q.tryAcquire(rpcTask(2, "")) {
+		t.Fatal("超过全局限制应排队")
+	}
+	started := make(chan int, 2)
+	waitAsync(q, rpcTask(2, ""), started)
+	waitAsync(q, rpcTask(3, ""), started)
+
+	q.release(first)
+	if id := <-started; id != 2 {
+		t.Fatalf("应按排队顺序执行, 期望任务2, 实际任务%d", id)
+	}
+	select {
+	case id := <-started:
+		t.Fatalf("超过全局限制, 任务%d不应执行", id)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.release(rpcTask(2, ""))
+	if id := <-started; id != 3 {
+		t.Fatalf("期望任务3, 实际任务%d", id)
+	}
+}
+
+func TestRunQueueTagAndHostLimit(t *testing.T) {
+	q := newTestRunQueue(concurrencyLimits{
+		tags:  map[string]int{"report": 1},
+		hosts: map[int16]int{1: 1},
+	})
+	if !q.tryAcquire(rpcTask(1, "report", 2)) {
+		t.Fatal("未超过限制应直接执行")
+	}
+	if q.tryAcquire(rpcTask(2, "report", 3)) {
+		t.Fatal("超过标签限制应排队")
+	}
+	if !q.tryAcquire(rpcTask(3, "other", 1)) {
+		t.Fatal("不同标签不受限制")
+	}
+	if q.tryAcquire(rpcTask(4, "", 1)) {
+		t.Fatal("超过节点限制应排队")
+	}
+	if !q.tryAcquire(rpcTask(5, "", 2)) {
+		t.Fatal("未限制的节点不受限制")
+	}
+}
+
+func TestRunQueueCancel(t *testing.T) {
+	q := newTestRunQueue(concurrencyLimits{global: 1})
+	q.tryAcquire(rpcTask(1, ""))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.wait(ctx, rpcTask(2, ""), 2); err == nil {
+		t.Fatal("取消后应返回错误")
+	}
+	if q.waiters.Len() != 0 {
+		t.Fatal("取消后应从队列中删除")
+	}
+}
+
+func TestRunQueuePositions(t *testing.T) {
+	q := newTestRunQueue(concurrencyLimits{
+		tags: map[string]int{"report": 1, "sync": 1},
+	})
+	q.tryAcquire(rpcTask(1, "report"))
+	q.tryAcquire(rpcTask(2, "sync"))
+	started := make(chan int, 3)
+	waitAsync(q, rpcTask(3, "report"), started)
+	waitAsync(q, rpcTask(4, "sync"), started)
+	waitAsync(q, rpcTask(5, "report"), started)
+
+	positions := q.positions()
+	expected := map[int64]int{3: 1, 4: 1, 5: 2}
+	for taskLogId, position := range expected {
+		if positions[taskLogId] != position {
+			t.Fatalf("日志%d排队位置期望%d, 实际%d", taskLogId, position, positions[taskLogId])
+		}
+	}
+}
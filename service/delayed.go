@@ -0,0 +1,132 @@
+package service
+
+// 延迟执行
+// 指定时间后执行一次任务, 记录保存在数据库中, 调度器重启或主备切换后重新加载未执行的记录
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+	"gocron/modules/scheduler"
+)
+
+// 最大延迟时间
+const MaxDelay = 30 * 24 * time.Hour
+
+// 延迟执行调度器, 以延迟执行记录ID为索引
+var delayedScheduler = scheduler.New()
+
+// 延迟指定时间后执行任务, params覆盖任务参数默认值, 返回延迟执行记录ID
+func (task *Task) RunLater(taskModel models.Task, delay time.Duration, params map[string]string) (int, error) {
+	if delay <= 0 || delay > MaxDelay {
+		return 0, errors.New("延迟时间取值1分钟-30天")
+	}
+	if createHandler(taskModel) == nil {
+		return 0, errors.New("不支持的任务协议")
+	}
+	delayedRunModel := new(models.DelayedRun)
+	delayedRunModel.TaskId = taskModel.Id
+	delayedRunModel.RunAt = time.Now().Add(delay).Truncate(time.Second)
+	delayedRunModel.Status = models.Running
+	if len(params) > 0 {
+		value, err := json.Marshal(params)
+		if err != nil {
+			return 0, err
+		}
+		delayedRunModel.Params = string(value)
+	}
+	id, err := delayedRunModel.Create()
+	if err != nil {
+		return 0, err
+	}
+	if !IsLeader() {
+		notifyLeader()
+		return id, nil
+	}
+	addDelayedRun(*delayedRunModel)
+
+	return id, nil
+}
+
+// 取消延迟执行, 已执行或已取消返回false
+func (task *Task) CancelDelayed(id int) (bool, error) {
+	delayedRunModel := new(models.DelayedRun)
+	cancelled, err := delayedRunModel.Cancel(id)
+	if err != nil || !cancelled {
+		return false, err
+	}
+	if !IsLeader() {
+		notifyLeader()
+		return true, nil
+	}
+	delayedScheduler.Remove(id)
+
+	return true, nil
+}
+
+// 清空调度器, 重新加载所有等待执行的记录
+func loadDelayedRuns() error {
+	delayedRunModel := new(models.DelayedRun)
+	list, err := delayedRunModel.PendingList()
+	if err != nil {
+		return err
+	}
+	delayedScheduler.Clear()
+	for _, item := range list {
+		addDelayedRun(item)
+	}
+
+	return nil
+}
+
+// 添加到调度器, 执行时间已过(调度器停止期间错过)时立即执行
+func addDelayedRun(delayedRun models.DelayedRun) {
+	schedule := newOnceSchedule(delayedRun.RunAt, time.Now())
+	delayedScheduler.Add(delayedRun.Id, schedule, scheduler.FuncJob(func(scheduledTime time.Time) {
+		if !IsLeader() {
+			logger.Warnf("当前实例不是主节点, 忽略延迟执行#ID-%d", delayedRun.Id)
+			return
+		}
+		delayedScheduler.Remove(delayedRun.Id)
+		runDelayed(delayedRun)
+	}))
+}
+
+func runDelayed(delayedRun models.DelayedRun) {
+	delayedRunModel := new(models.DelayedRun)
+	// 标记为已执行后再执行, 已取消的不执行
+	fired, err := delayedRunModel.Fire(delayedRun.Id)
+	if err != nil {
+		logger.Errorf("延迟执行#更新状态失败#ID-%d#%s", delayedRun.Id, err.Error())
+		return
+	}
+	if !fired {
+		return
+	}
+	taskModel := new(models.Task)
+	task, err := taskModel.Detail(delayedRun.TaskId)
+	if err != nil || task.Id <= 0 {
+		logger.Errorf("延迟执行#获取任务详情失败#任务ID-%d", delayedRun.TaskId)
+		return
+	}
+	handler := createHandler(task)
+	if handler == nil {
+		return
+	}
+	params := make(map[string]string)
+	if delayedRun.Params != "" {
+		err = json.Unmarshal([]byte(delayedRun.Params), &params)
+		if err != nil {
+			logger.Errorf("延迟执行#解析任务参数失败#ID-%d#%s", delayedRun.Id, err.Error())
+		}
+	}
+	runWorkflow(handler, task, RunContext{
+		Type:          models.TaskTypeDelayed,
+		ScheduledTime: delayedRun.RunAt,
+		Params:        params,
+		LeaseToken:    leaseToken(),
+	})
+}
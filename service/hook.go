@@ -0,0 +1,81 @@
+package service
+
+// 失败处理、成功处理任务
+// 任务执行失败(含超时、取消)或成功后执行设置的处理任务, 处理任务可获取任务的执行结果和错误信息, 与下游任务相同
+// 处理任务只执行一次, 不触发自身的下游任务和处理任务
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gocron/models"
+	"gocron/modules/logger"
+)
+
+// 按任务执行结果执行失败处理或成功处理任务
+func runHooks(taskModel models.Task, taskResult TaskResult, runContext RunContext) {
+	// 应用退出或当前实例不再是主节点, 不再执行处理任务
+	if taskResult.Interrupted || taskResult.Err == errLeaseLost {
+		return
+	}
+	hookIds := selectHooks(taskModel, taskResult)
+	if len(hookIds) == 0 {
+		return
+	}
+	result := newUpstreamResult(taskModel.Id, taskResult)
+	upstream := upstreamContext{
+		upstreamResult: result,
+		Upstreams:      map[int]upstreamResult{taskModel.Id: result},
+	}
+	for _, hookId := range hookIds {
+		go runHook(hookId, upstream, runContext)
+	}
+}
+
+// 执行失败(含超时、取消)返回失败处理任务, 执行成功返回成功处理任务
+func selectHooks(taskModel models.Task, taskResult TaskResult) []int {
+	value := taskModel.SuccessHookIds
+	if taskResult.Err != nil {
+		value = taskModel.FailureHookIds
+	}
+	hookIds := make([]int, 0)
+	for _, idStr := range strings.Split(value, ",") {
+		hookId, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if err != nil || hookId <= 0 || hookId == taskModel.Id {
+			continue
+		}
+		hookIds = append(hookIds, hookId)
+	}
+
+	return hookIds
+}
+
+// 处理任务使用与任务相同的计划执行时间
+func runHook(hookId int, upstream upstreamContext, taskRunContext RunContext) {
+	taskModel := new(models.Task)
+	hookModel, err := taskModel.Detail(hookId)
+	if err != nil || hookModel.Id <= 0 {
+		logger.Errorf("获取处理任务失败#任务ID-%d#处理任务ID-%d", upstream.TaskId, hookId)
+		return
+	}
+	handler := createHandler(hookModel)
+	if handler == nil {
+		logger.Error("创建任务处理Job失败,不支持的任务协议#", hookModel.Protocol)
+		return
+	}
+	if upstream.Status == upstreamStatusSuccess {
+		hookModel.Spec = fmt.Sprintf("成功处理(任务ID-%d)", upstream.TaskId)
+	} else {
+		hookModel.Spec = fmt.Sprintf("失败处理(任务ID-%d)", upstream.TaskId)
+	}
+	logger.Infof("执行处理任务#任务ID-%d#状态-%s#处理任务ID-%d", upstream.TaskId, upstream.Status, hookId)
+	runJob(handler, hookModel, RunContext{
+		Type:          models.TaskTypeHook,
+		ScheduledTime: taskRunContext.ScheduledTime,
+		WorkflowRunId: taskRunContext.WorkflowRunId,
+		Location:      taskRunContext.Location,
+		Upstream:      upstream,
+		LeaseToken:    taskRunContext.LeaseToken,
+	})
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gocron/models"
+)
+
+func TestSelectHooks(t *testing.T) {
+	taskModel := models.Task{Id: 1, FailureHookIds: "2, 3,1", SuccessHookIds: "4"}
+	if hookIds := selectHooks(taskModel, TaskResult{}); !reflect.DeepEqual(hookIds, []int{4}) {
+		t.Fatalf("执行成功应返回成功处理任务, 实际%v", hookIds)
+	}
+	if hookIds := selectHooks(taskModel, TaskResult{Err: errOverlapSkipped}); !reflect.DeepEqual(hookIds, []int{2, 3}) {
+		t.Fatalf("执行失败应返回失败处理任务且不包含任务自身, 实际%v", hookIds)
+	}
+	if hookIds := selectHooks(models.Task{Id: 1}, TaskResult{Err: errors.New("exit status 1")}); len(hookIds) != 0 {
+		t.Fatalf("未设置处理任务, 实际%v", hookIds)
+	}
+}
+
+func TestHookUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		taskResult TaskResult
+		status     string
+	}{
+		{TaskResult{Result: "ok"}, upstreamStatusSuccess},
+		{TaskResult{Err: errors.New("exit status 1")}, upstreamStatusFailure},
+		{TaskResult{Err: errHTTPTimeout}, upstreamStatusTimeout},
+		{TaskResult{Err: errOverlapSkipped}, upstreamStatusCancelled},
+		{TaskResult{Err: errors.New(replacedMessage), Replaced: true}, upstreamStatusCancelled},
+	}
+	for _, test := range tests {
+		result := newUpstreamResult(1, test.taskResult)
+		if result.Status != test.status {
+			t.Fatalf("期望%s, 实际%s", test.status, result.Status)
+		}
+		if test.taskResult.Err != nil && result.Error != test.taskResult.Err.Error() {
+			t.Fatalf("应记录失败原因, 实际%s", result.Error)
+		}
+	}
+}
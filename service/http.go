@@ -0,0 +1,103 @@
+package service
+
+// HTTP任务请求
+// URL、查询参数值、请求头值、请求体、认证信息中可使用命令模板变量, 每次执行(含重试)前渲染
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gocron/models"
+	"gocron/modules/httpclient"
+)
+
+func newHttpRequest(taskModel models.Task, vars commandVars) (httpclient.Request, error) {
+	request := httpclient.Request{
+		Method:  strings.ToUpper(taskModel.HttpMethod),
+		Url:     renderCommand(taskModel, vars),
+		Header:  make(http.Header),
+		Timeout: taskModel.Timeout,
+		Options: httpOptions(taskModel),
+	}
+	if request.Method == "" {
+		request.Method = "GET"
+	}
+
+	queryList, err := taskModel.HttpQueryList()
+	if err != nil {
+		return request, err
+	}
+	if len(queryList) > 0 {
+		u, err := url.Parse(request.Url)
+		if err != nil {
+			return request, err
+		}
+		query := u.Query()
+		for _, item := range queryList {
+			query.Add(item.Key, renderTemplate(taskModel, vars, item.Value))
+		}
+		u.RawQuery = query.Encode()
+		request.Url = u.String()
+	}
+
+	headerList, err := taskModel.HttpHeaderList()
+	if err != nil {
+		return request, err
+	}
+	for _, item := range headerList {
+		request.Header.Add(item.Key, renderTemplate(taskModel, vars, item.Value))
+	}
+
+	switch taskModel.HttpBodyType {
+	case models.TaskHttpBodyForm:
+		formList, err := taskModel.HttpFormList()
+		if err != nil {
+			return request, err
+		}
+		form := make(url.Values)
+		for _, item := range formList {
+			form.Add(item.Key, renderTemplate(taskModel, vars, item.Value))
+		}
+		request.Body = form.Encode()
+		setDefaultHeader(request.Header, "Content-Type", "application/x-www-form-urlencoded")
+	case models.TaskHttpBodyJSON:
+		request.Body = renderTemplate(taskModel, vars, taskModel.HttpBody)
+		setDefaultHeader(request.Header, "Content-Type", "application/json")
+	}
+
+	switch taskModel.HttpAuthType {
+	case models.TaskHttpAuthBasic:
+		credentials := renderTemplate(taskModel, vars, taskModel.HttpAuthUser) + ":" + renderTemplate(taskModel, vars, taskModel.HttpAuthSecret)
+		request.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	case models.TaskHttpAuthBearer:
+		request.Header.Set("Authorization", "Bearer "+renderTemplate(taskModel, vars, taskModel.HttpAuthSecret))
+	}
+
+	return request, nil
+}
+
+// 任务的TLS、代理、重定向设置
+func httpOptions(taskModel models.Task) httpclient.Options {
+	return httpclient.Options{
+		CaCert:             taskModel.HttpCaCert,
+		ClientCert:         taskModel.HttpClientCert,
+		ClientKey:          taskModel.HttpClientKey,
+		InsecureSkipVerify: taskModel.HttpInsecureSkipVerify == 1,
+		Proxy:              taskModel.HttpProxy,
+		Redirect:           int(taskModel.HttpRedirect),
+	}
+}
+
+// CheckHttpOptions 校验任务的TLS、代理、重定向设置
+func CheckHttpOptions(taskModel models.Task) error {
+	return httpclient.CheckOptions(httpOptions(taskModel))
+}
+
+// 未设置时使用默认值
+func setDefaultHeader(header http.Header, key string, value string) {
+	if header.Get(key) == "" {
+		header.Set(key, value)
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"gocron/models"
+)
+
+// 计算任务启动延迟, 避免大量相同crontab表达式的任务同时执行
+// 随机方式每次执行的延迟不同, 固定方式同一任务每次延迟相同, 不同任务均匀分散在延迟范围内
+func jitterDelay(taskModel models.Task) time.Duration {
+	if taskModel.Jitter <= 0 {
+		return 0
+	}
+	window := int64(time.Duration(taskModel.Jitter) * time.Second / time.Millisecond)
+	var delay int64
+	if taskModel.JitterMode == models.TaskJitterDeterministic {
+		hash := fnv.New32a()
+		hash.Write([]byte(strconv.Itoa(taskModel.Id)))
+		delay = int64(hash.Sum32()) % window
+	} else {
+		delay = rand.Int63n(window)
+	}
+
+	return time.Duration(delay) * time.Millisecond
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gocron/models"
+)
+
+func TestJitterDelay(t *testing.T) {
+	taskModel := models.Task{Id: 1}
+	if delay := jitterDelay(taskModel); delay != 0 {
+		t.Fatalf("未设置延迟, 实际延迟%s", delay)
+	}
+
+	taskModel.Jitter = 10
+	for i := 0; i < 100; i++ {
+		delay := jitterDelay(taskModel)
+		if delay < 0 || delay >= 10*time.Second {
+			t.Fatalf("延迟超出范围-%s", delay)
+		}
+	}
+
+	taskModel.JitterMode = models.TaskJitterDeterministic
+	delay := jitterDelay(taskModel)
+	if delay < 0 || delay >= 10*time.Second {
+		t.Fatalf("延迟超出范围-%s", delay)
+	}
+	for i := 0; i < 10; i++ {
+		if jitterDelay(taskModel) != delay {
+			t.Fatal("固定延迟方式每次计算结果应相同")
+		}
+	}
+}
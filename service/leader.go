@@ -0,0 +1,215 @@
+package service
+
+// 调度器主备模式
+// 多个调度器实例连接同一数据库, 通过抢占数据库中的租约选出主节点, 只有主节点调度任务
+// 主节点定时续约, 续约失败或租约到期后停止调度, 备节点在租约过期后接管
+// 调度执行时携带租约token(fencing token), 写入任务日志、排队结束开始执行时在数据库中校验租约, 租约已被其他实例抢占时不执行
+// 主节点暂停(GC、虚拟机停顿)超过租约有效期后恢复, 也不会在新主节点接管后开始新的执行; 已开始的执行不中断, 执行结果照常写入
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/app"
+	"gocron/modules/logger"
+)
+
+var errLeaseLost = errors.New("租约已失效, 当前实例不再是主节点, 取消执行")
+
+// 默认租约有效期(秒)
+const defaultLeaseTtl = 10
+
+type leaderState struct {
+	leading  bool
+	token    int64     // 当前持有租约的fencing token
+	deadline time.Time // 本地计算的租约到期时间, 早于数据库中的到期时间
+	revision int64     // 已加载的任务配置版本号
+	sync.RWMutex
+}
+
+var leader leaderState
+
+// 当前实例是否为主节点, 未开启主备模式时始终为主节点
+func IsLeader() bool {
+	if !haEnabled() {
+		return true
+	}
+	leader.RLock()
+	defer leader.RUnlock()
+
+	return leader.leading && time.Now().Before(leader.deadline)
+}
+
+// 调度执行时携带的租约token, 未开启主备模式或不是主节点时为0
+func leaseToken() int64 {
+	if !haEnabled() {
+		return 0
+	}
+	leader.RLock()
+	defer leader.RUnlock()
+	if !leader.leading {
+		return 0
+	}
+
+	return leader.token
+}
+
+// 获取当前主节点实例ID
+func LeaderId() (string, error) {
+	if !haEnabled() {
+		return app.InstanceId, nil
+	}
+	leaseModel := new(models.Lease)
+	lease, err := leaseModel.Get(models.LeaseScheduler)
+	if err != nil {
+		return "", err
+	}
+	if lease.ExpiredAt.IsZero() {
+		return "", nil
+	}
+
+	return lease.Holder, nil
+}
+
+// 开始主节点选举, 未开启主备模式时直接初始化任务调度
+func (task *Task) StartLeaderElection() {
+	if !haEnabled() {
+		task.Initialize()
+		return
+	}
+	leaseModel := new(models.Lease)
+	err := leaseModel.Init(models.LeaseScheduler)
+	if err != nil {
+		logger.Fatal("主备选举#初始化租约失败", err)
+	}
+	// 备节点手动执行任务时也受并发数限制
+	err = loadConcurrencyLimits()
+	if err != nil {
+		logger.Error("加载任务并发数限制失败", err)
+	}
+	go task.runLeaderElection()
+}
+
+// 主动释放租约, 备节点可立即接管
+func (task *Task) ResignLeader() {
+	if !haEnabled() {
+		return
+	}
+	leader.Lock()
+	defer leader.Unlock()
+	if !leader.leading {
+		return
+	}
+	leader.leading = false
+	leaseModel := new(models.Lease)
+	err := leaseModel.Release(models.LeaseScheduler, app.InstanceId, leader.token)
+	if err != nil {
+		logger.Error("主备选举#释放租约失败", err)
+	}
+}
+
+func (task *Task) runLeaderElection() {
+	ttl := leaseTtl()
+	// 每个租约周期内至少续约两次
+	interval := time.Duration(ttl) * time.Second / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	for {
+		task.electOrRenew(ttl)
+		time.Sleep(interval)
+	}
+}
+
+func (task *Task) electOrRenew(ttl int) {
+	leaseModel := new(models.Lease)
+	start := time.Now()
+	leader.RLock()
+	leading, token := leader.leading, leader.token
+	leader.RUnlock()
+
+	if !leading {
+		acquired, lease, err := leaseModel.Acquire(models.LeaseScheduler, app.InstanceId, ttl)
+		if err != nil {
+			logger.Error("主备选举#抢占租约失败", err)
+			return
+		}
+		if !acquired {
+			return
+		}
+		leader.Lock()
+		leader.leading = true
+		leader.token = lease.Token
+		leader.revision = lease.Revision
+		leader.deadline = start.Add(time.Duration(ttl) * time.Second)
+		leader.Unlock()
+		logger.Infof("主备选举#当前实例成为主节点#实例ID-%s#token-%d", app.InstanceId, lease.Token)
+		task.Initialize()
+		return
+	}
+
+	renewed, lease, err := leaseModel.Renew(models.LeaseScheduler, app.InstanceId, token, ttl)
+	if err != nil {
+		logger.Error("主备选举#续约失败", err)
+		// 数据库暂时不可用, 租约到期前继续调度
+		if IsLeader() {
+			return
+		}
+		task.stepDown()
+		return
+	}
+	if !renewed {
+		logger.Warnf("主备选举#租约已被其他实例抢占#主节点-%s", lease.Holder)
+		task.stepDown()
+		return
+	}
+	leader.Lock()
+	leader.deadline = start.Add(time.Duration(ttl) * time.Second)
+	revision := leader.revision
+	leader.revision = lease.Revision
+	leader.Unlock()
+
+	// 其他实例修改了任务配置, 重新加载
+	if lease.Revision != revision {
+		logger.Info("主备选举#任务配置已变更, 重新加载任务")
+		_, err = task.reload()
+		if err != nil {
+			logger.Error("主备选举#重新加载任务失败", err)
+		}
+	}
+}
+
+// 失去主节点身份, 停止任务调度
+func (task *Task) stepDown() {
+	leader.Lock()
+	leader.leading = false
+	leader.Unlock()
+	logger.Warnf("主备选举#当前实例不再是主节点, 停止任务调度#实例ID-%s", app.InstanceId)
+	task.StopAll()
+}
+
+// 非主节点修改了任务配置, 通知主节点重新加载
+func notifyLeader() {
+	if !haEnabled() || !app.Installed {
+		return
+	}
+	leaseModel := new(models.Lease)
+	err := leaseModel.IncrRevision(models.LeaseScheduler)
+	if err != nil {
+		logger.Error("主备选举#更新任务配置版本号失败", err)
+	}
+}
+
+func haEnabled() bool {
+	return app.Setting != nil && app.Setting.HaEnable
+}
+
+func leaseTtl() int {
+	if app.Setting.HaLeaseTtl <= 0 {
+		return defaultLeaseTtl
+	}
+
+	return app.Setting.HaLeaseTtl
+}
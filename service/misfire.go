@@ -0,0 +1,116 @@
+package service
+
+import (
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+	"gocron/modules/scheduler"
+)
+
+// 计算错过的执行时间点时最多遍历的次数, 防止秒级任务停机过久时长时间计算
+const maxMisfireScanTimes = 100000
+
+// 任务错过的执行时间点
+type misfire struct {
+	taskModel models.Task
+	times     []time.Time
+}
+
+// 计算调度器停止期间错过的执行时间点, until为调度器启动时间
+// 需在调度器启动前调用, 否则启动后立即执行的任务写入的日志会覆盖最近一次执行时间, 错过的时间点丢失
+func collectMisfires(tasks []models.Task, until time.Time) []misfire {
+	misfires := make([]misfire, 0)
+	for _, item := range tasks {
+		// 单次执行任务错过时由调度器直接执行
+		if item.MisfirePolicy == models.TaskMisfireIgnore || item.IsOnce() {
+			continue
+		}
+		times := taskMisfireTimes(item, until)
+		if len(times) > 0 {
+			misfires = append(misfires, misfire{taskModel: item, times: times})
+		}
+	}
+
+	return misfires
+}
+
+// 以任务最近一次执行开始时间为起点, 按任务策略计算错过的时间点
+func taskMisfireTimes(taskModel models.Task, until time.Time) []time.Time {
+	taskLogModel := new(models.TaskLog)
+	lastStartTime, err := taskLogModel.LastStartTime(taskModel.Id)
+	if err != nil {
+		logger.Errorf("补偿执行#获取任务最近执行时间失败#任务ID-%d#%s", taskModel.Id, err.Error())
+		return nil
+	}
+	// 从未执行过的任务无需补偿
+	if lastStartTime.IsZero() {
+		return nil
+	}
+	schedule, err := parseSchedule(taskModel)
+	if err != nil {
+		logger.Errorf("补偿执行#crontab表达式解析失败#任务ID-%d#%s", taskModel.Id, err.Error())
+		return nil
+	}
+
+	return calcMisfireTimes(schedule, taskModel, lastStartTime, until)
+}
+
+// 补偿执行错过的时间点
+func catchUpMisfires(misfires []misfire) {
+	for _, item := range misfires {
+		go catchUpMisfire(item.taskModel, item.times)
+	}
+}
+
+func catchUpMisfire(taskModel models.Task, misfireTimes []time.Time) {
+	handler := createHandler(taskModel)
+	if handler == nil {
+		return
+	}
+	logger.Infof("补偿执行#任务ID-%d#补偿执行次数-%d", taskModel.Id, len(misfireTimes))
+	// 按时间顺序依次执行, 上一次执行完成后才执行下一次
+	for _, scheduledTime := range misfireTimes {
+		runContext := RunContext{
+			Type:          models.TaskTypeMisfire,
+			ScheduledTime: scheduledTime,
+			LeaseToken:    leaseToken(),
+		}
+		if skipByCalendar(taskModel, runContext) {
+			continue
+		}
+		runWorkflow(handler, taskModel, runContext)
+	}
+}
+
+// 计算(from, until)之间需要补偿执行的时间点
+func calcMisfireTimes(schedule scheduler.Schedule, taskModel models.Task, from, until time.Time) []time.Time {
+	times := make([]time.Time, 0)
+	next := schedule.Next(from)
+	for i := 0; i < maxMisfireScanTimes; i++ {
+		if next.IsZero() || !next.Before(until) {
+			break
+		}
+		switch taskModel.MisfirePolicy {
+		case models.TaskMisfireRunOnce:
+			// 只补偿最近一次错过的时间点
+			if len(times) == 0 {
+				times = append(times, next)
+			} else {
+				times[0] = next
+			}
+		case models.TaskMisfireRunAll:
+			if len(times) >= int(taskModel.MisfireLimit) {
+				logger.Warnf("补偿执行#错过次数超过上限, 超出部分不再补偿#任务ID-%d#上限-%d",
+					taskModel.Id, taskModel.MisfireLimit)
+				return times
+			}
+			times = append(times, next)
+		default:
+			return times
+		}
+		next = schedule.Next(next)
+	}
+
+	return times
+}
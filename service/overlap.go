@@ -0,0 +1,125 @@
+package service
+
+// 同一任务上次执行未结束时的处理
+// 跳过: 不执行; 排队: 最多保留一个等待中的执行, 上次执行结束后开始;
+// 终止上次执行: 取消正在执行和等待中的实例后执行; 多实例运行: 同时运行的实例数不超过上限
+
+import (
+	"sync"
+
+	"gocron/models"
+
+	"golang.org/x/net/context"
+)
+
+const replacedMessage = "任务被新的执行终止"
+
+// 任务的一次执行
+type instanceSlot struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending bool // 需等待正在执行的实例结束
+	started bool
+}
+
+// 同一任务的所有执行
+type taskInstance struct {
+	slots   map[*instanceSlot]bool
+	running int
+	changed chan struct{} // 有实例结束时关闭并重新创建
+}
+
+// 任务ID作为Key
+type Instance struct {
+	tasks map[int]*taskInstance
+	sync.Mutex
+}
+
+// 按任务重叠执行策略申请执行, 需跳过本次执行时返回false
+func (i *Instance) admit(taskModel models.Task) (*instanceSlot, bool) {
+	i.Lock()
+	defer i.Unlock()
+	ti, ok := i.tasks[taskModel.Id]
+	if !ok {
+		ti = &taskInstance{slots: make(map[*instanceSlot]bool), changed: make(chan struct{})}
+		i.tasks[taskModel.Id] = ti
+	}
+
+	pending := false
+	switch taskModel.Overlap() {
+	case models.TaskOverlapSkip:
+		if len(ti.slots) > 0 {
+			return nil, false
+		}
+	case models.TaskOverlapQueue:
+		if len(ti.slots) > ti.running {
+			return nil, false
+		}
+		pending = ti.running > 0
+	case models.TaskOverlapReplace:
+		for slot := range ti.slots {
+			slot.cancel()
+		}
+		pending = ti.running > 0
+	default:
+		if taskModel.MaxInstances > 0 && len(ti.slots) >= int(taskModel.MaxInstances) {
+			return nil, false
+		}
+	}
+
+	slot := &instanceSlot{pending: pending}
+	slot.ctx, slot.cancel = context.WithCancel(taskContext)
+	if !pending {
+		slot.started = true
+		ti.running++
+	}
+	ti.slots[slot] = true
+
+	return slot, true
+}
+
+// 等待正在执行的实例结束, 执行被取消时返回错误
+func (i *Instance) waitStart(taskId int, slot *instanceSlot) error {
+	for {
+		i.Lock()
+		if slot.ctx.Err() != nil {
+			i.Unlock()
+			return slot.ctx.Err()
+		}
+		ti := i.tasks[taskId]
+		if ti.running == 0 {
+			slot.started = true
+			slot.pending = false
+			ti.running++
+			i.Unlock()
+			return nil
+		}
+		changed := ti.changed
+		i.Unlock()
+
+		select {
+		case <-changed:
+		case <-slot.ctx.Done():
+		}
+	}
+}
+
+// 执行结束
+func (i *Instance) done(taskId int, slot *instanceSlot) {
+	i.Lock()
+	defer i.Unlock()
+	slot.cancel()
+	ti, ok := i.tasks[taskId]
+	if !ok {
+		return
+	}
+	delete(ti.slots, slot)
+	if slot.started {
+		ti.running--
+	}
+	close(ti.changed)
+	ti.changed = make(chan struct{})
+	if len(ti.slots) == 0 {
+		delete(i.tasks, taskId)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gocron/models"
+)
+
+func newTestInstance() *Instance {
+	return &Instance{tasks: make(map[int]*taskInstance)}
+}
+
+func TestOverlapSkip(t *testing.T) {
+	instance := newTestInstance()
+	taskModel := models.Task{Id: 1, OverlapPolicy: models.TaskOverlapSkip}
+	slot, ok := instance.admit(taskModel)
+	if !ok || slot.pending {
+		t.Fatal("没有正在执行的实例时应直接执行")
+	}
+	if _, ok := instance.admit(taskModel); ok {
+		t.Fatal("上次执行未结束应跳过")
+	}
+	instance.done(taskModel.Id, slot)
+	if _, ok := instance.admit(taskModel); !ok {
+		t.Fatal("上次执行结束后应执行")
+	}
+}
+
+func TestOverlapQueue(t *testing.T) {
+	instance := newTestInstance()
+	taskModel := models.Task{Id: 1, OverlapPolicy: models.TaskOverlapQueue}
+	first, _ := instance.admit(taskModel)
+	second, ok := instance.admit(taskModel)
+	if !ok || !second.pending {
+		t.Fatal("上次执行未结束应排队")
+	}
+	if _, ok := instance.admit(taskModel); ok {
+		t.Fatal("最多一个排队中的执行")
+	}
+
+	started := make(chan error)
+	go func() {
+		started <- instance.waitStart(taskModel.Id, second)
+	}()
+	select {
+	case <-started:
+		t.Fatal("上次执行结束前不应开始")
+	case <-time.After(20 * time.Millisecond):
+	}
+	instance.done(taskModel.Id, first)
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverlapReplace(t *testing.T) {
+	instance := newTestInstance()
+	taskModel := models.Task{Id: 1, OverlapPolicy: models.TaskOverlapReplace}
+	first, _ := instance.admit(taskModel)
+	second, ok := instance.admit(taskModel)
+	if !ok || !second.pending {
+		t.Fatal("应等待上次执行终止")
+	}
+	if first.ctx.Err() == nil {
+		t.Fatal("上次执行应被取消")
+	}
+	taskResult := canceledResult("output", 0)
+	if !taskResult.Replaced || taskResult.Interrupted || taskResult.Err.Error() != replacedMessage {
+		t.Fatalf("应为被新的执行终止, 实际%+v", taskResult)
+	}
+	instance.done(taskModel.Id, first)
+	if err := instance.waitStart(taskModel.Id, second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverlapParallel(t *testing.T) {
+	instance := newTestInstance()
+	taskModel := models.Task{Id: 1, OverlapPolicy: models.TaskOverlapParallel, MaxInstances: 2}
+	for i := 0; i < 2; i++ {
+		if _, ok := instance.admit(taskModel); !ok {
+			t.Fatal("未超过最大实例数应执行")
+		}
+	}
+	if _, ok := instance.admit(taskModel); ok {
+		t.Fatal("超过最大实例数应跳过")
+	}
+
+	// 兼容Multi字段
+	legacy := models.Task{Id: 2, Multi: 1}
+	for i := 0; i < 10; i++ {
+		if _, ok := instance.admit(legacy); !ok {
+			t.Fatal("允许多实例运行时不限制实例数")
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+// 提交后轮询的HTTP任务
+// 提交请求成功后按JSONPath从响应中获取任务ID, 按轮询间隔请求查询地址(GET, 使用任务的请求头和认证信息)
+// 响应满足任一失败条件时失败, 满足全部成功条件时成功, 超过任务超时时间仍未结束视为超时, 最后一次查询的响应作为执行结果
+// 查询请求失败、响应状态码不符合预期或不是有效的JSON时继续轮询
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"gocron/models"
+	"gocron/modules/httpclient"
+)
+
+// 默认轮询间隔(单位秒)
+const DefaultPollInterval = 10
+
+var errPollTimeout = errors.New("轮询任务状态超时")
+
+// 轮询结果满足失败条件
+type pollFailureError string
+
+func (e pollFailureError) Error() string {
+	return "任务状态满足失败条件-" + string(e)
+}
+
+// 执行提交后轮询的HTTP任务
+func runPollHttp(ctx context.Context, taskModel models.Task, vars commandVars) (string, error) {
+	if taskModel.Timeout <= 0 {
+		return "", errors.New("提交后轮询的HTTP任务需设置超时时间")
+	}
+	pollCtx, cancel := context.WithTimeout(ctx, time.Duration(taskModel.Timeout)*time.Second)
+	defer cancel()
+	// 单次请求的超时时间
+	if taskModel.Timeout > HttpExecTimeout {
+		taskModel.Timeout = HttpExecTimeout
+	}
+
+	request, err := newHttpRequest(taskModel, vars)
+	if err != nil {
+		return "", err
+	}
+	startTime := time.Now()
+	resp := httpclient.Do(pollCtx, request)
+	if resp.Timeout {
+		return resp.Body, errHTTPTimeout
+	}
+	err = checkHttpResponse(taskModel, resp, time.Since(startTime))
+	if err != nil {
+		if resp.StatusCode > 0 {
+			return resp.Body + "\n\n" + err.Error(), err
+		}
+		return resp.Body, err
+	}
+	jobId, err := extractJobId(taskModel, resp.Body)
+	if err != nil {
+		return resp.Body + "\n\n" + err.Error(), err
+	}
+	vars.Run.JobId = jobId
+
+	pollTask := pollRequestTask(taskModel)
+	interval := time.Duration(taskModel.HttpPollInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultPollInterval * time.Second
+	}
+	result := resp.Body
+	for {
+		select {
+		case <-time.After(interval):
+		case <-pollCtx.Done():
+			return result, pollContextError(ctx)
+		}
+		request, err = newHttpRequest(pollTask, vars)
+		if err != nil {
+			return result, err
+		}
+		resp = httpclient.Do(pollCtx, request)
+		if pollCtx.Err() != nil {
+			return result, pollContextError(ctx)
+		}
+		if resp.StatusCode == 0 || !taskModel.AcceptHttpStatus(resp.StatusCode) {
+			continue
+		}
+		result = resp.Body
+		done, err := checkPollResponse(taskModel, resp.Body)
+		if done {
+			return result, err
+		}
+	}
+}
+
+// 任务被停止时返回停止原因, 否则为轮询超时
+func pollContextError(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return errPollTimeout
+}
+
+// 查询任务状态的请求, 使用任务的请求头和认证信息
+func pollRequestTask(taskModel models.Task) models.Task {
+	taskModel.Command = taskModel.HttpPollUrl
+	taskModel.HttpMethod = "GET"
+	taskModel.HttpQuery = ""
+	taskModel.HttpBodyType = models.TaskHttpBodyNone
+	taskModel.HttpBody = ""
+
+	return taskModel
+}
+
+// 从提交请求的响应中获取任务ID
+func extractJobId(taskModel models.Task, body string) (string, error) {
+	document, err := decodeJSON(body)
+	if err != nil {
+		return "", httpAssertionError("响应内容不是有效的JSON, 无法获取任务ID")
+	}
+	segments, err := parseJSONPath(taskModel.HttpJobIdPath)
+	if err != nil {
+		return "", err
+	}
+	value, ok := lookupJSON(document, segments)
+	if !ok || value == nil {
+		return "", httpAssertionError("响应中未找到任务ID-" + taskModel.HttpJobIdPath)
+	}
+	jobId := strings.TrimSpace(formatJSON(value))
+	if jobId == "" {
+		return "", httpAssertionError("任务ID为空-" + taskModel.HttpJobIdPath)
+	}
+
+	return jobId, nil
+}
+
+// 检查查询任务状态的响应, 未满足成功或失败条件时done为false
+func checkPollResponse(taskModel models.Task, body string) (done bool, err error) {
+	document, err := decodeJSON(body)
+	if err != nil {
+		return false, nil
+	}
+	failures, err := taskModel.HttpPollFailureList()
+	if err != nil {
+		return true, err
+	}
+	for _, item := range failures {
+		if assertJSON(document, item.Key, item.Value) == nil {
+			return true, pollFailureError(fmt.Sprintf("%s == %s", item.Key, item.Value))
+		}
+	}
+	successes, err := taskModel.HttpPollSuccessList()
+	if err != nil {
+		return true, err
+	}
+	if len(successes) == 0 {
+		return true, errors.New("未设置成功条件")
+	}
+	for _, item := range successes {
+		if assertJSON(document, item.Key, item.Value) != nil {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// 校验轮询配置
+func CheckHttpPoll(taskModel models.Task) error {
+	if _, err := parseJSONPath(taskModel.HttpJobIdPath); err != nil {
+		return errors.New("任务ID" + err.Error())
+	}
+	if strings.TrimSpace(taskModel.HttpPollUrl) == "" {
+		return errors.New("请输入查询任务状态的URL")
+	}
+	successes, err := taskModel.HttpPollSuccessList()
+	if err != nil {
+		return err
+	}
+	if len(successes) == 0 {
+		return errors.New("请输入成功条件")
+	}
+	failures, err := taskModel.HttpPollFailureList()
+	if err != nil {
+		return err
+	}
+	for _, item := range append(successes, failures...) {
+		if _, err = parseJSONPath(item.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
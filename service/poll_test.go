@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"gocron/models"
+)
+
+func TestExtractJobId(t *testing.T) {
+	taskModel := models.Task{HttpJobIdPath: "$.data.job_id"}
+	tests := map[string]string{
+		`{"data": {"job_id": "a1b2"}}`: "a1b2",
+		`{"data": {"job_id": 42}}`:     "42",
+	}
+	for body, expected := range tests {
+		jobId, err := extractJobId(taskModel, body)
+		if err != nil || jobId != expected {
+			t.Fatalf("期望%s, 实际%s-%v", expected, jobId, err)
+		}
+	}
+	for _, body := range []string{`{"data": {}}`, `{"data": {"job_id": null}}`, `{"data": {"job_id": ""}}`, "accepted"} {
+		if _, err := extractJobId(taskModel, body); err == nil {
+			t.Fatalf("%s应获取任务ID失败", body)
+		}
+	}
+}
+
+func TestCheckPollResponse(t *testing.T) {
+	taskModel := models.Task{
+		HttpPollSuccess: "$.status == \"success\"\n$.progress == 100",
+		HttpPollFailure: "$.status == \"failed\"",
+	}
+	tests := []struct {
+		body    string
+		done    bool
+		success bool
+	}{
+		{`{"status": "running", "progress": 50}`, false, false},
+		{`{"status": "success", "progress": 99}`, false, false},
+		{`{"status": "success", "progress": 100}`, true, true},
+		{`{"status": "failed", "progress": 100}`, true, false},
+		{"<html>", false, false},
+	}
+	for _, test := range tests {
+		done, err := checkPollResponse(taskModel, test.body)
+		if done != test.done || (done && (err == nil) != test.success) {
+			t.Fatalf("%s期望%v-%v, 实际%v-%v", test.body, test.done, test.success, done, err)
+		}
+	}
+}
+
+func TestCheckHttpPoll(t *testing.T) {
+	taskModel := models.Task{
+		HttpJobIdPath:   "$.job_id",
+		HttpPollUrl:     "http://127.0.0.1/jobs/{{.Run.JobId}}",
+		HttpPollSuccess: "$.status == \"success\"",
+	}
+	if err := CheckHttpPoll(taskModel); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []func(task *models.Task){
+		func(task *models.Task) { task.HttpJobIdPath = "job_id" },
+		func(task *models.Task) { task.HttpPollUrl = "" },
+		func(task *models.Task) { task.HttpPollSuccess = "" },
+		func(task *models.Task) { task.HttpPollFailure = "$.status" },
+	}
+	for i, modify := range invalid {
+		task := taskModel
+		modify(&task)
+		if err := CheckHttpPoll(task); err == nil {
+			t.Fatalf("第%d个配置应校验失败", i+1)
+		}
+	}
+}
+
+func TestRunPollHttp(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/jobs":
+			fmt.Fprint(w, `{"job_id": 7}`)
+		case r.Method == "GET" && r.URL.Path == "/jobs/7":
+			polls++
+			fmt.Fprint(w, `{"status": "success", "rows": 3}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	taskModel := models.Task{
+		Command:          server.URL + "/jobs",
+		HttpMethod:       "POST",
+		HttpAuthType:     models.TaskHttpAuthBearer,
+		HttpAuthSecret:   "secret",
+		HttpAsync:        models.TaskHttpPoll,
+		HttpJobIdPath:    "$.job_id",
+		HttpPollUrl:      server.URL + "/jobs/{{.Run.JobId}}",
+		HttpPollInterval: 1,
+		HttpPollSuccess:  "$.status == \"success\"",
+		Timeout:          10,
+	}
+	result, err := runPollHttp(context.Background(), taskModel, commandVars{})
+	if err != nil || result != `{"status": "success", "rows": 3}` || polls != 1 {
+		t.Fatalf("轮询结果错误-%s-%v-%d", result, err, polls)
+	}
+
+	taskModel.HttpPollSuccess = "$.status == \"finished\""
+	taskModel.Timeout = 1
+	_, err = runPollHttp(context.Background(), taskModel, commandVars{})
+	if err != errPollTimeout || !isTimeout(err) {
+		t.Fatalf("期望轮询超时, 实际%v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+// 调度器异常退出后, 遗留的执行中任务日志无法再被更新
+// 每个调度器实例定时上报心跳, 所属实例已不存活的执行中日志标记为异常中止
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/app"
+	"gocron/modules/logger"
+)
+
+const (
+	// 实例心跳间隔
+	instanceHeartbeatInterval = 10 * time.Second
+	// 超过此时间(秒)没有心跳的实例视为已退出
+	instanceExpiredSeconds = 60
+	// 检查遗留日志间隔
+	reconcileInterval = time.Minute
+)
+
+// 注册当前调度器实例, 标记已退出实例遗留的任务日志, 并定时上报心跳
+func (task *Task) RegisterInstance() {
+	instanceModel := new(models.SchedulerInstance)
+	instanceModel.Id = app.InstanceId
+	instanceModel.Hostname, _ = os.Hostname()
+	instanceModel.Pid = os.Getpid()
+	err := instanceModel.Register()
+	if err != nil {
+		logger.Error("注册调度器实例失败", err)
+	}
+	reconcileOrphanLogs()
+	go runInstanceHeartbeat()
+}
+
+// 注销当前调度器实例
+func (task *Task) UnregisterInstance() {
+	instanceModel := new(models.SchedulerInstance)
+	err := instanceModel.Unregister(app.InstanceId)
+	if err != nil {
+		logger.Error("注销调度器实例失败", err)
+	}
+}
+
+func runInstanceHeartbeat() {
+	instanceModel := new(models.SchedulerInstance)
+	heartbeatTicker := time.NewTicker(instanceHeartbeatInterval)
+	reconcileTicker := time.NewTicker(reconcileInterval)
+	for {
+		select {
+		case <-heartbeatTicker.C:
+			err := instanceModel.UpdateHeartbeat(app.InstanceId)
+			if err != nil {
+				logger.Error("调度器实例上报心跳失败", err)
+			}
+		case <-reconcileTicker.C:
+			// 主备模式下其他实例可能异常退出, 定时检查
+			reconcileOrphanLogs()
+		}
+	}
+}
+
+// 标记已退出实例遗留的执行中日志为异常中止
+func reconcileOrphanLogs() {
+	instanceModel := new(models.SchedulerInstance)
+	_, err := instanceModel.RemoveExpired(instanceExpiredSeconds)
+	if err != nil {
+		logger.Error("删除已退出的调度器实例失败", err)
+	}
+	aliveIds, err := instanceModel.AliveIds(instanceExpiredSeconds)
+	if err != nil {
+		logger.Error("获取存活的调度器实例失败", err)
+		return
+	}
+	// 当前实例心跳可能尚未写入
+	aliveIds = append(aliveIds, app.InstanceId)
+
+	taskLogModel := new(models.TaskLog)
+	orphanLogs, err := taskLogModel.OrphanList(aliveIds)
+	if err != nil {
+		logger.Error("获取遗留的任务日志失败", err)
+		return
+	}
+	for _, taskLog := range orphanLogs {
+		result := fmt.Sprintf("调度器实例[%s]在任务执行期间异常退出, 执行结果未知", taskLog.Instance)
+		if taskLog.Instance == "" {
+			result = "调度器在任务执行期间异常退出, 执行结果未知"
+		}
+		abandoned, err := taskLogModel.Abandon(taskLog.Id, result)
+		if err != nil {
+			logger.Errorf("标记任务日志异常中止失败#日志ID-%d#%s", taskLog.Id, err.Error())
+			continue
+		}
+		// 已被其他实例处理
+		if !abandoned {
+			continue
+		}
+		logger.Warnf("任务日志标记为异常中止#任务ID-%d#日志ID-%d", taskLog.TaskId, taskLog.Id)
+		if app.Setting.OrphanNotify {
+			notifyOrphanLog(taskLog, result)
+		}
+	}
+	reconcileOrphanWorkflowRuns(aliveIds)
+}
+
+// 标记已退出实例遗留的执行中工作流运行记录为异常中止
+func reconcileOrphanWorkflowRuns(aliveIds []string) {
+	runModel := new(models.WorkflowRun)
+	orphanRuns, err := runModel.OrphanList(aliveIds)
+	if err != nil {
+		logger.Error("获取遗留的工作流运行记录失败", err)
+		return
+	}
+	for _, run := range orphanRuns {
+		_, err := runModel.Finish(run.Id, models.Abandoned)
+		if err != nil {
+			logger.Errorf("标记工作流运行记录异常中止失败#运行记录ID-%d#%s", run.Id, err.Error())
+			continue
+		}
+		logger.Warnf("工作流运行记录标记为异常中止#任务ID-%d#运行记录ID-%d", run.TaskId, run.Id)
+	}
+}
+
+// 发送失败通知
+func notifyOrphanLog(taskLog models.TaskLog, result string) {
+	taskModel := new(models.Task)
+	task, err := taskModel.Detail(taskLog.TaskId)
+	if err != nil || task.Id <= 0 {
+		return
+	}
+	SendNotification(task, TaskResult{Result: result, Err: errors.New(result)})
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+	rpcClient "gocron/modules/rpc/client"
+)
+
+// 指数递增时最多翻倍的次数, 防止溢出
+const maxRetryShift = 20
+
+// 计算第retryTimes次重试前的等待时间, retryTimes从1开始
+func retryDelay(taskModel models.Task, retryTimes int8) time.Duration {
+	interval := time.Duration(taskModel.RetryInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	var delay time.Duration
+	switch taskModel.RetryPolicy {
+	case models.TaskRetryFixed:
+		delay = interval
+	case models.TaskRetryExponential:
+		shift := uint(retryTimes - 1)
+		if shift > maxRetryShift {
+			shift = maxRetryShift
+		}
+		delay = interval << shift
+	default:
+		delay = interval * time.Duration(retryTimes)
+	}
+	maxInterval := time.Duration(taskModel.RetryMaxInterval) * time.Second
+	if maxInterval > 0 && delay > maxInterval {
+		delay = maxInterval
+	}
+	// 在[delay/2, delay]之间随机, 避免多个任务同时重试
+	if taskModel.RetryJitter > 0 && delay >= 2*time.Second {
+		half := delay / 2
+		delay = half + time.Duration(rand.Int63n(int64(half/time.Second)+1))*time.Second
+	}
+
+	return delay
+}
+
+// 记录每次执行的输出, 未设置重试的任务不记录
+func recordAttempt(taskModel models.Task, taskLogId int64, attempt int8, startTime time.Time, taskResult TaskResult) {
+	if taskModel.RetryTimes <= 0 || taskLogId <= 0 {
+		return
+	}
+	attemptModel := new(models.TaskLogAttempt)
+	attemptModel.TaskLogId = taskLogId
+	attemptModel.Attempt = int16(attempt)
+	attemptModel.Output = taskResult.Result
+	attemptModel.StartTime = startTime
+	attemptModel.EndTime = time.Now()
+	switch {
+	case taskResult.Interrupted:
+		attemptModel.Status = models.Interrupted
+	case taskResult.Replaced:
+		attemptModel.Status = models.Cancel
+	case taskResult.Err != nil:
+		attemptModel.Status = models.Failure
+	default:
+		attemptModel.Status = models.Finish
+	}
+	if taskResult.Err != nil {
+		message := []rune(taskResult.Err.Error())
+		if len(message) > 1024 {
+			message = message[:1024]
+		}
+		attemptModel.Error = string(message)
+	}
+	_, err := attemptModel.Create()
+	if err != nil {
+		logger.Errorf("写入任务执行记录失败#日志ID-%d#%s", taskLogId, err.Error())
+	}
+}
+
+var errHTTPTimeout = errors.New("HTTP请求超时")
+
+// HTTP状态码不在成功状态码中
+type httpStatusError int
+
+func (e httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP状态码不符合预期-->%d", int(e))
+}
+
+// 任务节点返回的命令退出错误, 如exit status 1
+var exitStatusPattern = regexp.MustCompile(`^exit status (\d+)$`)
+
+// 多个主机执行失败, 保留每个主机的错误
+type hostErrors []error
+
+func (e hostErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// 错误分类, 命令退出码非0时同时返回退出码
+// 多个主机执行失败时, 所有错误分类相同才返回该分类, 否则为其他错误
+func classifyError(err error) (models.TaskErrorClass, int) {
+	if errs, ok := err.(hostErrors); ok {
+		class, exitCode := classifyError(errs[0])
+		for _, item := range errs[1:] {
+			itemClass, itemExitCode := classifyError(item)
+			if itemClass != class || itemExitCode != exitCode {
+				return models.TaskErrorOther, 0
+			}
+		}
+		return class, exitCode
+	}
+	if rpcClient.IsUnavailable(err) {
+		return models.TaskErrorUnavailable, 0
+	}
+	if rpcClient.IsTimeout(err) || err == errHTTPTimeout || err == errCallbackTimeout || err == errPollTimeout {
+		return models.TaskErrorTimeout, 0
+	}
+	if statusCode, ok := err.(httpStatusError); ok {
+		switch {
+		case statusCode == 0:
+			// 请求失败, 未收到响应
+			return models.TaskErrorUnavailable, 0
+		case statusCode >= 500 && statusCode < 600:
+			return models.TaskErrorHTTP5xx, 0
+		case statusCode >= 400 && statusCode < 500:
+			return models.TaskErrorHTTP4xx, 0
+		}
+		return models.TaskErrorOther, 0
+	}
+	matches := exitStatusPattern.FindStringSubmatch(err.Error())
+	if len(matches) == 2 {
+		code, _ := strconv.Atoi(matches[1])
+		return models.TaskErrorExitCode, code
+	}
+
+	return models.TaskErrorOther, 0
+}
+
+// 按任务设置判断执行失败后是否重试, 多个主机执行失败时所有错误都需重试才重试, 避免不可重试的主机重复执行
+func retryable(taskModel models.Task, err error) bool {
+	if errs, ok := err.(hostErrors); ok {
+		for _, item := range errs {
+			if !retryable(taskModel, item) {
+				return false
+			}
+		}
+		return true
+	}
+	class, exitCode := classifyError(err)
+	if class == models.TaskErrorExitCode {
+		return taskModel.RetryOnExitCode(exitCode)
+	}
+
+	return taskModel.RetryOnClass(class)
+}
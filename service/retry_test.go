@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gocron/models"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		taskModel  models.Task
+		retryTimes int8
+		expected   time.Duration
+	}{
+		{models.Task{RetryPolicy: models.TaskRetryFixed, RetryInterval: 30}, 1, 30 * time.Second},
+		{models.Task{RetryPolicy: models.TaskRetryFixed, RetryInterval: 30}, 5, 30 * time.Second},
+		// 默认与旧版本一致, 第n次重试间隔n分钟
+		{models.Task{RetryPolicy: models.TaskRetryLinear, RetryInterval: 60}, 3, 3 * time.Minute},
+		{models.Task{RetryPolicy: models.TaskRetryExponential, RetryInterval: 10}, 1, 10 * time.Second},
+		{models.Task{RetryPolicy: models.TaskRetryExponential, RetryInterval: 10}, 4, 80 * time.Second},
+		{models.Task{RetryPolicy: models.TaskRetryExponential, RetryInterval: 10, RetryMaxInterval: 60}, 4, 60 * time.Second},
+		{models.Task{RetryPolicy: models.TaskRetryExponential, RetryInterval: 1, RetryMaxInterval: 3600}, 100, time.Hour},
+	}
+	for i, test := range tests {
+		delay := retryDelay(test.taskModel, test.retryTimes)
+		if delay != test.expected {
+			t.Errorf("#%d 期望%s, 实际%s", i, test.expected, delay)
+		}
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	taskModel := models.Task{RetryPolicy: models.TaskRetryFixed, RetryInterval: 60, RetryJitter: 1}
+	for i := 0; i < 100; i++ {
+		delay := retryDelay(taskModel, 1)
+		if delay < 30*time.Second || delay > 60*time.Second {
+			t.Fatalf("随机抖动超出范围-%s", delay)
+		}
+		if delay%time.Second != 0 {
+			t.Fatalf("重试间隔应精确到秒-%s", delay)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		retryOn   string
+		exitCodes string
+		err       error
+		expected  bool
+	}{
+		{models.TaskRetryOnAll, "", errors.New("exit status 1"), true},
+		{models.TaskRetryOnAll, "", errors.New("任意错误"), true},
+		{"1,2", "", errors.New("exit status 1"), false},
+		{"1,2", "", errHTTPTimeout, true},
+		{"1,2", "", httpStatusError(0), true},
+		{"5", "", errors.New("exit status 2"), true},
+		{"5", "75,111", errors.New("exit status 75"), true},
+		{"5", "75,111", errors.New("exit status 1"), false},
+		{"3", "", httpStatusError(502), true},
+		{"3", "", httpStatusError(404), false},
+		{"4", "", httpStatusError(404), true},
+		{"6", "", httpStatusError(302), true},
+		{"", "", errors.New("exit status 1"), false},
+		// 多个主机执行失败, 所有错误都需重试才重试
+		{"1,2", "", hostErrors{errHTTPTimeout, httpStatusError(0)}, true},
+		{"1,2", "", hostErrors{errors.New("exit status 1"), httpStatusError(0)}, false},
+		{"5", "1", hostErrors{errors.New("exit status 1"), errors.New("exit status 1")}, true},
+	}
+	for i, test := range tests {
+		taskModel := models.Task{RetryOn: test.retryOn, RetryExitCodes: test.exitCodes}
+		if retryable(taskModel, test.err) != test.expected {
+			t.Errorf("#%d %s 期望%v", i, test.err, test.expected)
+		}
+	}
+	if !isTimeout(hostErrors{errHTTPTimeout, errHTTPTimeout}) || isTimeout(hostErrors{errHTTPTimeout, errors.New("exit status 1")}) {
+		t.Error("多个主机执行失败时, 所有错误都为超时才视为超时")
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/scheduler"
+
+	"github.com/jakecoffman/cron"
+)
+
+// 解析任务crontab表达式, 按任务时区计算执行时间
+func parseSchedule(taskModel models.Task) (scheduler.Schedule, error) {
+	if taskModel.IsOnce() {
+		return newOnceSchedule(taskModel.RunAt, time.Now()), nil
+	}
+	location, err := LoadLocation(taskModel.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := cron.Parse(taskModel.Spec)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := schedule.(*cron.SpecSchedule)
+	if !ok {
+		// @every 等固定间隔任务与时区无关
+		return schedule, nil
+	}
+
+	return zonedSchedule{spec: spec, location: location}, nil
+}
+
+// 加载时区, 为空时使用服务器时区
+func LoadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+// 按指定时区的墙上时间计算执行时间
+// 夏令时开始时跳过的时间点顺延到跳变之后执行, 夏令时结束时重复的时间点只执行一次
+type zonedSchedule struct {
+	spec     *cron.SpecSchedule
+	location *time.Location
+}
+
+func (s zonedSchedule) Next(t time.Time) time.Time {
+	wall := wallClock(t.In(s.location))
+	for {
+		wall = s.spec.Next(wall)
+		if wall.IsZero() {
+			return wall
+		}
+		next := wallToLocation(wall, s.location)
+		// 墙上时间对应的时刻不晚于t, 说明该时间点已执行过(时钟回拨), 跳过
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// 单次执行任务
+type onceSchedule struct {
+	at time.Time
+}
+
+// 执行时间已过(调度器停止期间错过)时, 添加到调度器后立即执行
+func newOnceSchedule(runAt, now time.Time) onceSchedule {
+	if !runAt.After(now) {
+		runAt = now.Add(time.Second)
+	}
+
+	return onceSchedule{at: runAt}
+}
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if s.at.After(t) {
+		return s.at
+	}
+
+	return time.Time{}
+}
+
+// 把时刻转换为UTC表示的墙上时间, UTC没有夏令时, 可直接按crontab规则计算
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// 把墙上时间转换为指定时区的时刻
+func wallToLocation(wall time.Time, location *time.Location) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, location)
+	if wallClock(t).Equal(wall) {
+		return t
+	}
+	// 墙上时间不存在(夏令时开始时跳过的时间段), 按跳变前的时区偏移量换算, 即顺延到跳变之后
+	_, offset := t.AddDate(0, 0, -1).Zone()
+
+	return wall.Add(-time.Duration(offset) * time.Second).In(location)
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/scheduler"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("加载时区失败-%s", err)
+	}
+
+	return location
+}
+
+func collectNextTimes(t *testing.T, taskModel models.Task, from, until time.Time) []time.Time {
+	schedule, err := parseSchedule(taskModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := make([]time.Time, 0)
+	for next := schedule.Next(from); next.Before(until); next = schedule.Next(next) {
+		times = append(times, next)
+	}
+
+	return times
+}
+
+func TestZonedScheduleSpringForward(t *testing.T) {
+	location := mustLoadLocation(t, "America/New_York")
+	taskModel := models.Task{Spec: "0 30 2 * * *", Timezone: "America/New_York"}
+	from := time.Date(2026, 3, 7, 0, 0, 0, 0, location)
+	until := time.Date(2026, 3, 10, 0, 0, 0, 0, location)
+	times := collectNextTimes(t, taskModel, from, until)
+	if len(times) != 3 {
+		t.Fatalf("执行次数不匹配, 目标3次, 实际%d次-%v", len(times), times)
+	}
+	// 2:30不存在, 顺延到3:30执行
+	expected := time.Date(2026, 3, 8, 3, 30, 0, 0, location)
+	if !times[1].Equal(expected) {
+		t.Fatalf("执行时间不匹配, 目标%s, 实际%s", expected, times[1])
+	}
+}
+
+func TestZonedScheduleFallBack(t *testing.T) {
+	mustLoadLocation(t, "America/New_York")
+	taskModel := models.Task{Spec: "0 30 1 * * *", Timezone: "America/New_York"}
+	from := time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 11, 3, 0, 0, 0, 0, time.UTC)
+	times := collectNextTimes(t, taskModel, from, until)
+	// 1:30出现两次, 只执行一次
+	if len(times) != 3 {
+		t.Fatalf("执行次数不匹配, 目标3次, 实际%d次-%v", len(times), times)
+	}
+}
+
+func TestZonedScheduleEveryMinuteAcrossFallBack(t *testing.T) {
+	mustLoadLocation(t, "Australia/Sydney")
+	taskModel := models.Task{Spec: "0 * * * * *", Timezone: "Australia/Sydney"}
+	from := time.Date(2026, 4, 4, 14, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 4, 4, 18, 0, 0, 0, time.UTC)
+	times := collectNextTimes(t, taskModel, from, until)
+	seen := make(map[string]bool)
+	for _, value := range times {
+		key := value.Format("2006-01-02 15:04:05")
+		if seen[key] {
+			t.Fatalf("墙上时间重复执行-%s", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestOnceSchedule(t *testing.T) {
+	now := time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC)
+	runAt := now.Add(30 * time.Minute)
+	schedule := newOnceSchedule(runAt, now)
+	if next := schedule.Next(now); !next.Equal(runAt) {
+		t.Fatalf("执行时间不匹配, 目标%s, 实际%s", runAt, next)
+	}
+	// 执行后不再执行
+	if next := schedule.Next(runAt); !next.IsZero() {
+		t.Fatalf("单次执行任务不应再次执行, 实际%s", next)
+	}
+
+	// 调度器停止期间错过的执行时间, 启动后立即执行
+	schedule = newOnceSchedule(now.Add(-time.Hour), now)
+	if next := schedule.Next(now); !next.After(now) || next.Sub(now) > time.Second {
+		t.Fatalf("错过的执行时间应立即执行, 实际%s", next)
+	}
+}
+
+func TestParseOnceSchedule(t *testing.T) {
+	runAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	taskModel := models.Task{ScheduleType: models.TaskScheduleOnce, RunAt: runAt}
+	schedule, err := parseSchedule(taskModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := schedule.Next(time.Now()); !next.Equal(runAt) {
+		t.Fatalf("执行时间不匹配, 目标%s, 实际%s", runAt, next)
+	}
+}
+
+// 添加单次执行任务后超过1秒才开始调度, 任务仍需执行
+func TestOnceScheduleDueBeforeStart(t *testing.T) {
+	s := scheduler.New()
+	result := make(chan time.Time, 1)
+	s.Add(1, newOnceSchedule(time.Now().Add(-time.Hour), time.Now()), scheduler.FuncJob(func(scheduledTime time.Time) {
+		result <- scheduledTime
+	}))
+	time.Sleep(1100 * time.Millisecond)
+	s.Start()
+	defer s.Stop()
+
+	select {
+	case <-result:
+	case <-time.After(time.Second):
+		t.Fatal("开始调度前已到期的单次执行任务未执行")
+	}
+}
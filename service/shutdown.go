@@ -0,0 +1,31 @@
+package service
+
+import (
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+)
+
+const interruptedMessage = "应用退出, 任务被中断"
+
+// 中断所有正在执行的任务, 取消节点上正在执行的命令
+// 等待waitTime让任务更新日志, 超时后仍未结束的任务日志直接标记为中断
+func (task *Task) InterruptAll(waitTime time.Duration) {
+	cancelTaskContext()
+	deadline := time.Now().Add(waitTime)
+	for TaskNum.Num() > 0 && time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	taskLogModel := new(models.TaskLog)
+	for _, taskLogId := range runningLogs.list() {
+		_, err := taskLogModel.Update(taskLogId, models.CommonMap{
+			"status": models.Interrupted,
+			"result": interruptedMessage,
+		})
+		if err != nil {
+			logger.Errorf("更新任务日志失败#日志ID-%d#%s", taskLogId, err.Error())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+// 任务SLA
+// 执行时间超过预期最长执行时间, 或每天最晚成功时间已过仍未执行成功时, 通过任务通知渠道发送预警, 不终止正在执行的任务
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/logger"
+	"gocron/modules/notify"
+	"gocron/modules/scheduler"
+
+	"github.com/jakecoffman/cron"
+)
+
+// 最晚成功时间检查调度器, 以任务ID为索引
+var slaScheduler = scheduler.New()
+
+// 解析每天最晚成功时间, 格式HH:MM
+func ParseSlaDeadline(value string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, 0, errors.New("最晚成功时间格式错误, 格式为HH:MM")
+	}
+
+	return t.Hour(), t.Minute(), nil
+}
+
+// 按任务时区计算每天检查最晚成功时间的时间点
+func parseSlaDeadlineSchedule(taskModel models.Task) (scheduler.Schedule, error) {
+	hour, minute, err := ParseSlaDeadline(taskModel.SlaDeadline)
+	if err != nil {
+		return nil, err
+	}
+	location, err := LoadLocation(taskModel.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := cron.Parse(fmt.Sprintf("0 %d %d * * *", minute, hour))
+	if err != nil {
+		return nil, err
+	}
+
+	return zonedSchedule{spec: schedule.(*cron.SpecSchedule), location: location}, nil
+}
+
+// 添加最晚成功时间检查, 未设置时删除
+func addSlaDeadline(taskModel models.Task) {
+	if taskModel.SlaDeadline == "" || taskModel.IsOnce() {
+		slaScheduler.Remove(taskModel.Id)
+		return
+	}
+	schedule, err := parseSlaDeadlineSchedule(taskModel)
+	if err != nil {
+		logger.Errorf("添加最晚成功时间检查失败#任务ID-%d#%s", taskModel.Id, err.Error())
+		return
+	}
+	slaScheduler.Add(taskModel.Id, schedule, scheduler.FuncJob(func(deadline time.Time) {
+		if !IsLeader() {
+			return
+		}
+		checkSlaDeadline(taskModel, deadline)
+	}))
+}
+
+// 当天(按任务时区)开始至最晚成功时间之间没有执行成功的记录时发送预警, 日历排除的日期不检查
+func checkSlaDeadline(taskModel models.Task, deadline time.Time) {
+	excluded, _, _ := excludedByCalendar(taskModel, deadline)
+	if excluded {
+		return
+	}
+	location, err := LoadLocation(taskModel.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+	local := deadline.In(location)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	taskLogModel := new(models.TaskLog)
+	succeeded, err := taskLogModel.SucceededBetween(taskModel.Id, dayStart, deadline)
+	if err != nil {
+		logger.Errorf("最晚成功时间检查#查询任务日志失败#任务ID-%d#%s", taskModel.Id, err.Error())
+		return
+	}
+	if succeeded {
+		return
+	}
+	output := fmt.Sprintf("最晚成功时间%s(%s)已过, 今天尚未执行成功", taskModel.SlaDeadline, location.String())
+	runningIds, err := taskLogModel.RunningIds(taskModel.Id)
+	if err == nil && len(runningIds) > 0 {
+		output += fmt.Sprintf("\n正在执行中, 日志ID: %v", runningIds)
+	}
+	logger.Warnf("最晚成功时间检查#任务未按时执行成功#任务ID-%d", taskModel.Id)
+	sendSlaAlert(taskModel, "未按时完成", output)
+}
+
+// 执行时间超过预期时发送预警, 返回的函数在执行结束后调用
+func watchSlaDuration(taskModel models.Task, taskLogId int64) (stop func()) {
+	if taskModel.SlaDuration <= 0 {
+		return func() {}
+	}
+	timer := time.AfterFunc(time.Duration(taskModel.SlaDuration)*time.Second, func() {
+		logger.Warnf("任务执行时间超过预期#任务ID-%d#日志ID-%d", taskModel.Id, taskLogId)
+		output := fmt.Sprintf("执行时间超过预期%d秒, 仍在执行中\n日志ID: %d", taskModel.SlaDuration, taskLogId)
+		sendSlaAlert(taskModel, "执行时间过长", output)
+	})
+
+	return func() {
+		timer.Stop()
+	}
+}
+
+// 通过任务通知渠道发送预警, 与任务通知设置(失败通知、执行结束通知)无关
+func sendSlaAlert(taskModel models.Task, statusName string, output string) {
+	if taskModel.NotifyType <= 0 || taskModel.NotifyReceiverId == "" {
+		return
+	}
+	msg := notify.Message{
+		"task_type":        taskModel.NotifyType,
+		"task_receiver_id": taskModel.NotifyReceiverId,
+		"name":             taskModel.Name,
+		"output":           output,
+		"status":           statusName,
+		"taskId":           taskModel.Id,
+	}
+	notify.Push(msg)
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gocron/models"
+)
+
+func TestParseSlaDeadline(t *testing.T) {
+	hour, minute, err := ParseSlaDeadline(" 08:30 ")
+	if err != nil || hour != 8 || minute != 30 {
+		t.Fatalf("解析错误-%d:%d-%v", hour, minute, err)
+	}
+	// 小时可省略前导0
+	hour, minute, err = ParseSlaDeadline("8:05")
+	if err != nil || hour != 8 || minute != 5 {
+		t.Fatalf("解析错误-%d:%d-%v", hour, minute, err)
+	}
+	for _, value := range []string{"", "24:00", "08:60", "08:30:00"} {
+		_, _, err = ParseSlaDeadline(value)
+		if err == nil {
+			t.Fatalf("应解析失败-%q", value)
+		}
+	}
+}
+
+func TestSlaDeadlineSchedule(t *testing.T) {
+	location := mustLoadLocation(t, "Asia/Shanghai")
+	taskModel := models.Task{SlaDeadline: "08:30", Timezone: "Asia/Shanghai"}
+	schedule, err := parseSlaDeadlineSchedule(taskModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 6, 1, 9, 0, 0, 0, location)
+	expected := time.Date(2026, 6, 2, 8, 30, 0, 0, location)
+	if next := schedule.Next(from); !next.Equal(expected) {
+		t.Fatalf("检查时间不匹配, 目标%s, 实际%s", expected, next)
+	}
+}
@@ -2,10 +2,10 @@ package service
 
 import (
     "gocron/models"
-    "strconv"
+    "gocron/modules/app"
     "time"
     "gocron/modules/logger"
-    "github.com/jakecoffman/cron"
+    "gocron/modules/scheduler"
     "errors"
     "fmt"
     "gocron/modules/httpclient"
@@ -13,15 +13,24 @@ import (
     "sync"
     rpcClient "gocron/modules/rpc/client"
     pb "gocron/modules/rpc/proto"
-    "strings"
+    "golang.org/x/net/context"
 )
 
 // 定时任务调度管理器
-var Cron *cron.Cron
-// 同一任务是否有实例处于运行中
-var runInstance Instance
+var taskScheduler = scheduler.New()
+// 同一任务正在执行的实例
+var runInstance = Instance{tasks: make(map[int]*taskInstance)}
 // 任务计数-正在运行中的任务
 var TaskNum TaskCount
+// 任务执行上下文, 应用退出超时后取消, 中断所有正在执行的任务
+var taskContext, cancelTaskContext = context.WithCancel(context.Background())
+// 正在执行中的任务日志
+var runningLogs = RunningLogs{ids: make(map[int64]bool)}
+
+var (
+    errOverlapSkipped = errors.New("上次执行未结束, 跳过本次执行")
+    errCreateTaskLog  = errors.New("写入任务日志失败")
+)
 
 // 任务计数
 type TaskCount struct {
@@ -48,34 +57,33 @@ func (c *TaskCount) Num() int  {
     return c.num
 }
 
-// 任务ID作为Key
-type Instance struct {
-    Status map[int]bool
+// 正在执行中的任务日志ID
+type RunningLogs struct {
+    ids map[int64]bool
     sync.RWMutex
 }
 
-// 是否有任务处于运行中
-func (i *Instance) has(key int) bool {
-    i.RLock()
-    defer i.RUnlock()
-    running, ok := i.Status[key]
-    if ok && running {
-        return true
-    }
-
-    return false
+func (r *RunningLogs) add(taskLogId int64) {
+    r.Lock()
+    defer r.Unlock()
+    r.ids[taskLogId] = true
 }
 
-func (i *Instance) add(key int)  {
-    i.Lock()
-    defer i.Unlock()
-    i.Status[key] = true
+func (r *RunningLogs) done(taskLogId int64) {
+    r.Lock()
+    defer r.Unlock()
+    delete(r.ids, taskLogId)
 }
 
-func (i *Instance) done(key int)  {
-    i.Lock()
-    defer i.Unlock()
-    delete(i.Status, key)
+func (r *RunningLogs) list() []int64 {
+    r.RLock()
+    defer r.RUnlock()
+    ids := make([]int64, 0, len(r.ids))
+    for id := range r.ids {
+        ids = append(ids, id)
+    }
+
+    return ids
 }
 
 type Task struct{}
@@ -84,26 +92,62 @@ type TaskResult struct {
     Result string
     Err error
     RetryTimes int8
+    Interrupted bool // 应用退出, 任务被中断
+    Replaced bool // 重叠执行策略为终止上次执行, 任务被新的执行终止
+    TaskLogId int64
+}
+
+// 单次运行信息
+type RunContext struct {
+    Type          models.TaskType // 运行类型
+    ScheduledTime time.Time       // 计划执行时间
+    Delay         time.Duration   // 启动延迟
+    WorkflowRunId int64           // 所属工作流运行记录
+    Location      *time.Location  // 根任务时区, 子任务和处理任务按根任务时区计算模板变量, nil使用任务自身时区
+    Upstream      upstreamContext // 上游任务信息, 子任务和处理任务使用
+    Params        map[string]string // 覆盖任务参数默认值
+    LeaseToken    int64           // 调度执行时持有的租约fencing token, 写入任务日志时校验, 0不校验(未开启主备模式或手动执行)
 }
 
 // 初始化任务, 从数据库取出所有任务, 添加到定时任务并运行
 func (task *Task) Initialize() {
-    Cron = cron.New()
-    Cron.Start()
-    runInstance = Instance{make(map[int]bool), sync.RWMutex{}}
-    TaskNum = TaskCount{0, sync.RWMutex{}}
-
-    taskModel := new(models.Task)
-    taskList, err := taskModel.ActiveList()
+    taskList, err := task.reload()
     if err != nil {
         logger.Error("定时任务初始化#获取任务列表错误-", err.Error())
         return
     }
+    // 调度器启动前计算错过的时间点, 以启动时间为截止时间
+    misfires := collectMisfires(taskList, time.Now())
+    taskScheduler.Start()
+    delayedScheduler.Start()
+    slaScheduler.Start()
     if len(taskList) == 0 {
         logger.Debug("任务列表为空")
         return
     }
+    catchUpMisfires(misfires)
+}
+
+// 清空调度器, 重新加载所有激活任务
+func (task *Task) reload() ([]models.Task, error) {
+    taskModel := new(models.Task)
+    taskList, err := taskModel.ActiveList()
+    if err != nil {
+        return nil, err
+    }
+    err = loadConcurrencyLimits()
+    if err != nil {
+        logger.Error("加载任务并发数限制失败", err)
+    }
+    taskScheduler.Clear()
+    slaScheduler.Clear()
     task.BatchAdd(taskList)
+    err = loadDelayedRuns()
+    if err != nil {
+        logger.Error("加载延迟执行记录失败", err)
+    }
+
+    return taskList, nil
 }
 
 // 批量添加任务
@@ -115,54 +159,142 @@ func (task *Task) BatchAdd(tasks []models.Task)  {
 
 // 添加任务
 func (task *Task) Add(taskModel models.Task) {
+    if !IsLeader() {
+        notifyLeader()
+        return
+    }
     if taskModel.Level == models.TaskLevelChild {
         logger.Errorf("添加任务失败#不允许添加子任务到调度器#任务Id-%d", taskModel.Id);
         return
     }
-    taskFunc := createJob(taskModel)
-    if taskFunc == nil {
+    handler := createHandler(taskModel)
+    if handler == nil {
         logger.Error("创建任务处理Job失败,不支持的任务协议#", taskModel.Protocol)
         return
     }
 
-    cronName := strconv.Itoa(taskModel.Id)
-    // Cron任务采用数组存储, 删除任务需遍历数组, 并对数组重新赋值, 任务较多时，有性能问题
-    Cron.RemoveJob(cronName)
-    err := Cron.AddFunc(taskModel.Spec, taskFunc, cronName)
+    schedule, err := parseSchedule(taskModel)
     if err != nil {
         logger.Error("添加任务到调度器失败#", err)
+        return
     }
+    addSlaDeadline(taskModel)
+
+    taskScheduler.Add(taskModel.Id, schedule, scheduler.FuncJob(func(scheduledTime time.Time) {
+        // 已失去主节点身份, 不再调度任务
+        if !IsLeader() {
+            logger.Warnf("当前实例不是主节点, 忽略任务调度#任务ID-%d", taskModel.Id)
+            return
+        }
+        runContext := RunContext{Type: models.TaskTypeNormal, ScheduledTime: scheduledTime, LeaseToken: leaseToken()}
+        if taskModel.IsOnce() {
+            if !finishOnceTask(taskModel) {
+                return
+            }
+            runContext.ScheduledTime = taskModel.RunAt
+            taskModel.Spec = "单次执行"
+        }
+        if skipByCalendar(taskModel, runContext) {
+            return
+        }
+        runContext.Delay = jitterDelay(taskModel)
+        if runContext.Delay > 0 {
+            select {
+            case <-time.After(runContext.Delay):
+            case <-taskContext.Done():
+                return
+            }
+            // 延迟期间可能已失去主节点身份
+            if !IsLeader() {
+                logger.Warnf("当前实例不是主节点, 忽略任务调度#任务ID-%d", taskModel.Id)
+                return
+            }
+        }
+        runWorkflow(handler, taskModel, runContext)
+    }))
+}
+
+// 单次执行任务触发后先停止任务再执行, 停止失败时不执行, 避免重启后重复执行
+func finishOnceTask(taskModel models.Task) bool {
+    taskScheduler.Remove(taskModel.Id)
+    _, err := taskModel.Disable(taskModel.Id)
+    if err != nil {
+        logger.Errorf("单次执行任务#停止任务失败#任务ID-%d#%s", taskModel.Id, err.Error())
+        return false
+    }
+
+    return true
+}
+
+// 从调度器中删除任务
+func (task *Task) Remove(id int) {
+    if !IsLeader() {
+        notifyLeader()
+        return
+    }
+    taskScheduler.Remove(id)
+    slaScheduler.Remove(id)
 }
 
 // 停止所有任务
 func (task *Task) StopAll()  {
-    Cron.Stop()
+    taskScheduler.Stop()
+    taskScheduler.Clear()
+    delayedScheduler.Stop()
+    delayedScheduler.Clear()
+    slaScheduler.Stop()
+    slaScheduler.Clear()
 }
 
-// 直接运行任务
-func (task *Task) Run(taskModel models.Task)  {
-    go createJob(taskModel)()
+// 直接运行任务, params覆盖任务参数默认值
+func (task *Task) Run(taskModel models.Task, params map[string]string)  {
+    handler := createHandler(taskModel)
+    if handler == nil {
+        return
+    }
+    go runWorkflow(handler, taskModel, RunContext{
+        Type: models.TaskTypeNormal,
+        ScheduledTime: time.Now().Truncate(time.Second),
+        Params: params,
+    })
 }
 
 type Handler interface {
-    Run(taskModel models.Task) (string, error)
+    Run(ctx context.Context, taskModel models.Task, vars commandVars) (string, error)
 }
 
 
 // HTTP任务
 type HTTPHandler struct{}
 
-// http任务执行时间不超过300秒
+// http请求执行时间不超过300秒
 const HttpExecTimeout = 300
 
-func (h *HTTPHandler) Run(taskModel models.Task) (result string, err error) {
+func (h *HTTPHandler) Run(ctx context.Context, taskModel models.Task, vars commandVars) (result string, err error) {
+    // 轮询模式下任务超时时间为整个执行过程的超时时间
+    if taskModel.HttpAsync == models.TaskHttpPoll {
+        return runPollHttp(ctx, taskModel, vars)
+    }
     if taskModel.Timeout <= 0 || taskModel.Timeout > HttpExecTimeout {
         taskModel.Timeout = HttpExecTimeout
     }
-    resp := httpclient.Get(taskModel.Command, taskModel.Timeout)
-    // 返回状态码非200，均为失败
-    if resp.StatusCode != 200 {
-        return resp.Body, errors.New(fmt.Sprintf("HTTP状态码非200-->%d", resp.StatusCode))
+    if taskModel.HttpAsync == models.TaskHttpCallback {
+        return runAsyncHttp(ctx, taskModel, vars)
+    }
+    request, err := newHttpRequest(taskModel, vars)
+    if err != nil {
+        return "", err
+    }
+    startTime := time.Now()
+    resp := httpclient.Do(ctx, request)
+    if resp.Timeout {
+        return resp.Body, errHTTPTimeout
+    }
+    // 状态码、响应时间、响应内容不满足成功条件时为失败
+    err = checkHttpResponse(taskModel, resp, time.Since(startTime))
+    if err != nil && resp.StatusCode > 0 {
+        // 失败原因记录到任务日志
+        return resp.Body + "\n\n" + err.Error(), err
     }
 
     return resp.Body, err
@@ -171,14 +303,19 @@ func (h *HTTPHandler) Run(taskModel models.Task) (result string, err error) {
 // RPC调用执行任务
 type RPCHandler struct {}
 
-func (h *RPCHandler) Run(taskModel models.Task) (result string, err error)  {
-    taskRequest := new(pb.TaskRequest)
-    taskRequest.Timeout = int32(taskModel.Timeout)
-    taskRequest.Command = taskModel.Command
+func (h *RPCHandler) Run(ctx context.Context, taskModel models.Task, vars commandVars) (result string, err error)  {
+    var env map[string]string
+    if vars.hasUpstream() {
+        env = vars.env()
+    }
     var resultChan chan TaskResult = make(chan TaskResult, len(taskModel.Hosts))
     for _, taskHost := range taskModel.Hosts {
         go func(th models.TaskHostDetail) {
-            output, err := rpcClient.ExecWithRetry(th.Name, th.Port, taskRequest)
+            taskRequest := new(pb.TaskRequest)
+            taskRequest.Timeout = int32(taskModel.Timeout)
+            taskRequest.Command = renderCommand(taskModel, vars.forHost(th))
+            taskRequest.Env = env
+            output, err := rpcClient.ExecWithRetry(ctx, th.Name, th.Port, taskRequest)
             var errorMessage string = ""
             if err != nil {
                 errorMessage = err.Error()
@@ -190,22 +327,29 @@ func (h *RPCHandler) Run(taskModel models.Task) (result string, err error)  {
         }(taskHost)
     }
 
-    var aggregationErr error = nil
+    var errs hostErrors
     var aggregationResult string = ""
     for i := 0; i < len(taskModel.Hosts); i++ {
         taskResult := <- resultChan
         aggregationResult += taskResult.Result
         if taskResult.Err != nil {
-            aggregationErr = taskResult.Err
+            errs = append(errs, taskResult.Err)
         }
     }
+    switch len(errs) {
+    case 0:
+        return aggregationResult, nil
+    case 1:
+        return aggregationResult, errs[0]
+    }
 
-    return aggregationResult, aggregationErr
+    // 多个主机执行失败时保留每个主机的错误, 按所有错误判断是否重试
+    return aggregationResult, errs
 }
 
 
 // 创建任务日志
-func createTaskLog(taskModel models.Task, status models.Status) (int64, error) {
+func createTaskLog(taskModel models.Task, status models.Status, runContext RunContext) (int64, error) {
     taskLogModel := new(models.TaskLog)
     taskLogModel.TaskId = taskModel.Id
     taskLogModel.Name = taskModel.Name
@@ -221,7 +365,20 @@ func createTaskLog(taskModel models.Task, status models.Status) (int64, error) {
         taskLogModel.Hostname = aggregationHost
     }
     taskLogModel.StartTime = time.Now()
+    taskLogModel.Type = runContext.Type
+    taskLogModel.ScheduledTime = runContext.ScheduledTime
+    taskLogModel.Delay = int(runContext.Delay / time.Millisecond)
+    taskLogModel.Instance = app.InstanceId
+    taskLogModel.WorkflowRunId = runContext.WorkflowRunId
     taskLogModel.Status = status
+    // 主备模式下调度执行时校验租约, 已失去主节点身份时不执行
+    if runContext.LeaseToken > 0 {
+        insertId, held, err := taskLogModel.CreateWithLease(models.LeaseScheduler, app.InstanceId, runContext.LeaseToken)
+        if err == nil && !held {
+            err = errLeaseLost
+        }
+        return insertId, err
+    }
     insertId, err := taskLogModel.Create()
 
     return insertId, err
@@ -232,7 +389,11 @@ func updateTaskLog(taskLogId int64, taskResult TaskResult) (int64, error) {
     taskLogModel := new(models.TaskLog)
     var status models.Status
     var result string = taskResult.Result
-    if taskResult.Err != nil {
+    if taskResult.Interrupted {
+        status = models.Interrupted
+    } else if taskResult.Replaced || taskResult.Err == errLeaseLost {
+        status = models.Cancel
+    } else if taskResult.Err != nil {
         status = models.Failure
     }  else {
         status = models.Finish
@@ -245,25 +406,50 @@ func updateTaskLog(taskLogId int64, taskResult TaskResult) (int64, error) {
 
 }
 
-func createJob(taskModel models.Task) cron.FuncJob {
-    var handler Handler = createHandler(taskModel)
-    if handler == nil {
-        return nil
-    }
-    taskFunc := func() {
-        TaskNum.Add()
-        defer TaskNum.Done()
-        taskLogId := beforeExecJob(taskModel)
-        if taskLogId <= 0 {
-            return
+// 运行任务, 执行完成后返回执行结果
+func runJob(handler Handler, taskModel models.Task, runContext RunContext) TaskResult {
+    TaskNum.Add()
+    defer TaskNum.Done()
+    slot, ok := runInstance.admit(taskModel)
+    if !ok {
+        taskLogId, _ := createTaskLog(taskModel, models.Cancel, runContext)
+        return TaskResult{Err: errOverlapSkipped, TaskLogId: taskLogId}
+    }
+    defer runInstance.done(taskModel.Id, slot)
+    taskLogId, queued, err := beforeExecJob(taskModel, runContext, slot)
+    if err == errLeaseLost {
+        logger.Warnf("当前实例不再是主节点, 取消执行#任务ID-%d", taskModel.Id)
+        return TaskResult{Err: errLeaseLost}
+    }
+    if taskLogId <= 0 {
+        return TaskResult{Err: errCreateTaskLog}
+    }
+    runningLogs.add(taskLogId)
+    defer runningLogs.done(taskLogId)
+    if queued {
+        err = waitInQueue(slot, taskModel, taskLogId, runContext.LeaseToken)
+        if err == errLeaseLost {
+            logger.Warnf("当前实例不再是主节点, 取消执行#任务ID-%d#日志ID-%d", taskModel.Id, taskLogId)
+            taskResult := TaskResult{Result: errLeaseLost.Error(), Err: errLeaseLost, TaskLogId: taskLogId}
+            updateTaskLog(taskLogId, taskResult)
+            return taskResult
+        }
+        if err != nil {
+            taskResult := canceledResult("", 0)
+            updateTaskLog(taskLogId, taskResult)
+            return taskResult
         }
-        logger.Infof("开始执行任务#%s#命令-%s", taskModel.Name, taskModel.Command)
-        taskResult := execJob(handler, taskModel)
-        logger.Infof("任务完成#%s#命令-%s", taskModel.Name, taskModel.Command)
-        afterExecJob(taskModel, taskResult, taskLogId)
     }
+    defer taskQueue.release(taskModel)
+    logger.Infof("开始执行任务#%s#命令-%s", taskModel.Name, taskModel.Command)
+    stopSlaWatch := watchSlaDuration(taskModel, taskLogId)
+    taskResult := execJob(slot.ctx, handler, taskModel, taskLogId, runContext)
+    stopSlaWatch()
+    logger.Infof("任务完成#%s#命令-%s", taskModel.Name, taskModel.Command)
+    taskResult.TaskLogId = taskLogId
+    afterExecJob(taskModel, taskResult, taskLogId)
 
-    return taskFunc
+    return taskResult
 }
 
 func createHandler(taskModel models.Task) Handler  {
@@ -279,24 +465,27 @@ func createHandler(taskModel models.Task) Handler  {
     return handler;
 }
 
-// 任务前置操作
-func beforeExecJob(taskModel models.Task) (taskLogId int64)  {
-    if taskModel.Multi == 0 && runInstance.has(taskModel.Id) {
-        createTaskLog(taskModel, models.Cancel)
-        return
-    }
-    if taskModel.Multi == 0 {
-        runInstance.add(taskModel.Id)
+// 任务前置操作, 需等待上次执行结束或超过并发数限制时queued为true, 需排队等待执行
+func beforeExecJob(taskModel models.Task, runContext RunContext, slot *instanceSlot) (taskLogId int64, queued bool, err error)  {
+    status := models.Running
+    queued = slot.pending || !taskQueue.tryAcquire(taskModel)
+    if queued {
+        status = models.Waiting
     }
-    taskLogId, err := createTaskLog(taskModel, models.Running)
+    taskLogId, err = createTaskLog(taskModel, status, runContext)
     if err != nil {
-        logger.Error("任务开始执行#写入任务日志失败-", err)
-        return
+        if err != errLeaseLost {
+            logger.Error("任务开始执行#写入任务日志失败-", err)
+        }
+        if !queued {
+            taskQueue.release(taskModel)
+        }
+        return 0, queued, err
     }
 
     logger.Debugf("任务命令-%s", taskModel.Command)
 
-    return taskLogId
+    return taskLogId, queued, nil
 }
 
 // 任务执行后置操作
@@ -308,44 +497,6 @@ func afterExecJob(taskModel models.Task, taskResult TaskResult, taskLogId int64)
 
     // 发送邮件
     go SendNotification(taskModel, taskResult)
-    // 执行依赖任务
-    go execDependencyTask(taskModel, taskResult)
-}
-
-// 执行依赖任务, 多个任务并发执行
-func execDependencyTask(taskModel models.Task, taskResult TaskResult)  {
-    // 父任务才能执行子任务
-    if taskModel.Level != models.TaskLevelParent {
-        return
-    }
-
-    // 是否存在子任务
-    dependencyTaskId := strings.TrimSpace(taskModel.DependencyTaskId)
-    if dependencyTaskId == "" {
-        return
-    }
-
-    // 父子任务关系为强依赖, 父任务执行失败, 不执行依赖任务
-    if taskModel.DependencyStatus == models.TaskDependencyStatusStrong && taskResult.Err != nil {
-        logger.Infof("父子任务为强依赖关系, 父任务执行失败, 不运行依赖任务#主任务ID-%d", taskModel.Id)
-        return
-    }
-
-    // 获取子任务
-    model := new(models.Task)
-    tasks , err := model.GetDependencyTaskList(dependencyTaskId)
-    if err != nil {
-        logger.Errorf("获取依赖任务失败#主任务ID-%d#%s", taskModel.Id, err.Error())
-        return
-    }
-    if len(tasks) == 0 {
-        logger.Errorf("依赖任务列表为空#主任务ID-%d", taskModel.Id)
-    }
-    serviceTask := new(Task)
-    for _, task := range tasks {
-        task.Spec = fmt.Sprintf("依赖任务(主任务ID-%d)", taskModel.Id)
-        serviceTask.Run(task)
-    }
 }
 
 // 发送任务结果通知
@@ -379,16 +530,13 @@ func SendNotification(taskModel models.Task, taskResult TaskResult)  {
     notify.Push(msg)
 }
 
-// 执行具体任务
-func execJob(handler Handler, taskModel models.Task) TaskResult  {
+// 执行具体任务, 每次执行的输出记录到taskLogId对应的执行记录中
+func execJob(ctx context.Context, handler Handler, taskModel models.Task, taskLogId int64, runContext RunContext) TaskResult  {
     defer func() {
        if err := recover(); err != nil {
            logger.Error("panic#service/task.go:execJob#", err)
        }
     } ()
-    if taskModel.Multi == 0 {
-        defer runInstance.done(taskModel.Id)
-    }
     // 默认只运行任务一次
     var execTimes int8 = 1
     if (taskModel.RetryTimes > 0) {
@@ -398,17 +546,52 @@ func execJob(handler Handler, taskModel models.Task) TaskResult  {
     var output string
     var err error
     for i < execTimes {
-        output, err = handler.Run(taskModel)
+        startTime := time.Now()
+        output, err = handler.Run(ctx, taskModel, newCommandVars(taskModel, runContext, taskLogId, int(i) + 1))
         if err == nil {
+            taskResult := TaskResult{Result: output, Err: err, RetryTimes: i}
+            recordAttempt(taskModel, taskLogId, i + 1, startTime, taskResult)
+            return taskResult
+        }
+        if ctx.Err() != nil {
+            taskResult := canceledResult(output, i)
+            recordAttempt(taskModel, taskLogId, i + 1, startTime, taskResult)
+            return taskResult
+        }
+        recordAttempt(taskModel, taskLogId, i + 1, startTime, TaskResult{Result: output, Err: err})
+        if !retryable(taskModel, err) {
+            if i + 1 < execTimes {
+                logger.Warnf("任务执行失败#任务id-%d#错误类型不需要重试#错误-%s", taskModel.Id, err.Error())
+            }
             return TaskResult{Result: output, Err: err, RetryTimes: i}
         }
         i++
         if i < execTimes {
-            logger.Warnf("任务执行失败#任务id-%d#重试第%d次#输出-%s#错误-%s", taskModel.Id, i, output, err.Error())
-            // 重试间隔时间，每次递增1分钟
-            time.Sleep( time.Duration(i) * time.Minute)
+            delay := retryDelay(taskModel, i)
+            logger.Warnf("任务执行失败#任务id-%d#%s后重试第%d次#输出-%s#错误-%s", taskModel.Id, delay, i, output, err.Error())
+            select {
+            case <-time.After(delay):
+            case <-ctx.Done():
+                return canceledResult(output, i - 1)
+            }
         }
     }
 
     return TaskResult{Result: output, Err: err, RetryTimes: taskModel.RetryTimes}
+}
+
+// 执行被取消, 应用退出时为中断, 否则为被新的执行终止
+func canceledResult(output string, retryTimes int8) TaskResult {
+    interrupted := taskContext.Err() != nil
+    message := replacedMessage
+    if interrupted {
+        message = interruptedMessage
+    }
+    return TaskResult{
+        Result: output + "\n" + message,
+        Err: errors.New(message),
+        RetryTimes: retryTimes,
+        Interrupted: interrupted,
+        Replaced: !interrupted,
+    }
 }
\ No newline at end of file
@@ -0,0 +1,151 @@
+package service
+
+// 上游任务执行结果传递给下游任务
+// shell任务通过环境变量获取, 命令、HTTP URL中可使用模板变量, 如 http://example.com/import?file={{.Outputs.file | urlquery}}
+// 上游任务输出中 ::output key=value 格式的行声明输出变量
+
+import (
+	"bufio"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gocron/models"
+)
+
+const (
+	upstreamStatusSuccess   = "success"
+	upstreamStatusFailure   = "failure"
+	upstreamStatusTimeout   = "timeout"
+	upstreamStatusCancelled = "cancelled"
+	upstreamStatusSkipped   = "skipped"
+)
+
+// 环境变量中上游任务输出的最大长度, 超出部分截断
+const maxUpstreamResultEnvSize = 64 * 1024
+
+const outputPrefix = "::output "
+
+var outputKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// 上游任务的一次执行
+type upstreamResult struct {
+	TaskId  int
+	LogId   int64
+	Status  string // success, failure, timeout, cancelled, skipped
+	Result  string
+	Error   string // 失败原因
+	Outputs map[string]string
+}
+
+// 下游任务执行时可使用的上游任务信息
+// 触发执行的上游任务信息直接使用, 如{{.LogId}}, 所有已完成上游任务按任务ID获取, 如{{(index .Upstreams 1).Result}}
+type upstreamContext struct {
+	upstreamResult
+	Upstreams map[int]upstreamResult
+}
+
+func newUpstreamResult(taskId int, taskResult TaskResult) upstreamResult {
+	result := upstreamResult{
+		TaskId:  taskId,
+		LogId:   taskResult.TaskLogId,
+		Status:  upstreamStatusSuccess,
+		Result:  taskResult.Result,
+		Outputs: parseOutputs(taskResult.Result),
+	}
+	if taskResult.Err == nil {
+		return result
+	}
+	result.Error = taskResult.Err.Error()
+	switch {
+	case taskResult.Err == errOverlapSkipped || taskResult.Err == errLeaseLost || taskResult.Interrupted || taskResult.Replaced:
+		result.Status = upstreamStatusCancelled
+	case isTimeout(taskResult.Err):
+		result.Status = upstreamStatusTimeout
+	default:
+		result.Status = upstreamStatusFailure
+	}
+
+	return result
+}
+
+func isTimeout(err error) bool {
+	class, _ := classifyError(err)
+
+	return class == models.TaskErrorTimeout
+}
+
+// 解析任务输出中声明的变量, 同名变量以最后一次声明为准
+func parseOutputs(result string) map[string]string {
+	outputs := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(result))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(result)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, outputPrefix) {
+			continue
+		}
+		pair := strings.SplitN(strings.TrimPrefix(line, outputPrefix), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(pair[0])
+		if !outputKeyPattern.MatchString(key) {
+			continue
+		}
+		outputs[key] = pair[1]
+	}
+
+	return outputs
+}
+
+// 传递给RPC任务的环境变量
+// GOCRON_UPSTREAM_TASK_ID、GOCRON_UPSTREAM_LOG_ID、GOCRON_UPSTREAM_STATUS、GOCRON_UPSTREAM_RESULT、GOCRON_UPSTREAM_ERROR: 触发执行的上游任务
+// GOCRON_UPSTREAM_<任务ID>_LOG_ID、GOCRON_UPSTREAM_<任务ID>_STATUS: 所有已完成的上游任务
+// GOCRON_OUTPUT_<变量名>: 上游任务声明的输出变量, 多个上游任务声明同名变量时以触发执行的上游任务为准, 其次为任务ID较大的
+func (c upstreamContext) env() map[string]string {
+	env := make(map[string]string)
+	taskIds := make([]int, 0, len(c.Upstreams))
+	for taskId := range c.Upstreams {
+		taskIds = append(taskIds, taskId)
+	}
+	sort.Ints(taskIds)
+	for _, taskId := range taskIds {
+		item := c.Upstreams[taskId]
+		prefix := "GOCRON_UPSTREAM_" + strconv.Itoa(taskId) + "_"
+		env[prefix+"LOG_ID"] = strconv.FormatInt(item.LogId, 10)
+		env[prefix+"STATUS"] = item.Status
+		if taskId == c.TaskId {
+			continue
+		}
+		for key, value := range item.Outputs {
+			env["GOCRON_OUTPUT_"+strings.ToUpper(key)] = value
+		}
+	}
+	env["GOCRON_UPSTREAM_TASK_ID"] = strconv.Itoa(c.TaskId)
+	env["GOCRON_UPSTREAM_LOG_ID"] = strconv.FormatInt(c.LogId, 10)
+	env["GOCRON_UPSTREAM_STATUS"] = c.Status
+	env["GOCRON_UPSTREAM_RESULT"] = truncateString(c.Result, maxUpstreamResultEnvSize)
+	if c.Error != "" {
+		env["GOCRON_UPSTREAM_ERROR"] = c.Error
+	}
+	for key, value := range c.Outputs {
+		env["GOCRON_OUTPUT_"+strings.ToUpper(key)] = value
+	}
+
+	return env
+}
+
+// 按字节截断, 不截断多字节字符
+func truncateString(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+	for size > 0 && !utf8.RuneStart(s[size]) {
+		size--
+	}
+
+	return s[:size]
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseOutputs(t *testing.T) {
+	result := "开始处理\n::output file=/data/20170601.csv\n  ::output batch_id=42  \n::output bad-key=1\n::output file=/data/20170602.csv\n::output empty\n"
+	expected := map[string]string{
+		"file":     "/data/20170602.csv",
+		"batch_id": "42",
+	}
+	outputs := parseOutputs(result)
+	if !reflect.DeepEqual(outputs, expected) {
+		t.Fatalf("期望%v, 实际%v", expected, outputs)
+	}
+}
+
+func TestUpstreamContext(t *testing.T) {
+	parent := newUpstreamResult(1, TaskResult{Result: "::output file=a.csv\n::output batch_id=42", TaskLogId: 100})
+	other := newUpstreamResult(2, TaskResult{Result: "::output file=b.csv\n::output date=2017-06-01", Err: errors.New("exit status 1"), TaskLogId: 101})
+	upstream := upstreamContext{
+		upstreamResult: parent,
+		Upstreams:      map[int]upstreamResult{1: parent, 2: other},
+	}
+
+	env := upstream.env()
+	expected := map[string]string{
+		"GOCRON_UPSTREAM_TASK_ID":  "1",
+		"GOCRON_UPSTREAM_LOG_ID":   "100",
+		"GOCRON_UPSTREAM_STATUS":   upstreamStatusSuccess,
+		"GOCRON_UPSTREAM_RESULT":   parent.Result,
+		"GOCRON_UPSTREAM_1_LOG_ID": "100",
+		"GOCRON_UPSTREAM_1_STATUS": upstreamStatusSuccess,
+		"GOCRON_UPSTREAM_2_LOG_ID": "101",
+		"GOCRON_UPSTREAM_2_STATUS": upstreamStatusFailure,
+		"GOCRON_OUTPUT_FILE":       "a.csv",
+		"GOCRON_OUTPUT_BATCH_ID":   "42",
+		"GOCRON_OUTPUT_DATE":       "2017-06-01",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("期望%v, 实际%v", expected, env)
+	}
+
+	vars := commandVars{upstreamContext: upstream}
+	command, err := vars.render("http://127.0.0.1/import?file={{.Outputs.file | urlquery}}&log={{.LogId}}&status={{(index .Upstreams 2).Status}}&x={{.Outputs.missing}}")
+	if err != nil || command != "http://127.0.0.1/import?file=a.csv&log=100&status=failure&x=" {
+		t.Fatalf("URL渲染错误-%s-%v", command, err)
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	if s := truncateString("任务输出", 7); s != "任务" {
+		t.Fatalf("不应截断多字节字符, 实际%q", s)
+	}
+	if s := truncateString("output", 10); s != "output" {
+		t.Fatalf("未超出长度不应截断, 实际%q", s)
+	}
+}
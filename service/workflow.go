@@ -0,0 +1,603 @@
+package service
+
+// 任务依赖工作流
+// 任务执行完成后沿依赖关系触发下游任务, 支持多级依赖
+// 下游任务按触发条件等待所有或任一上游任务, 同一次运行中每个任务最多执行一次
+// 汇聚任务的所有上游任务需来自同一根任务, 保存依赖时校验
+// 存在下游任务时创建工作流运行记录, 本次运行产生的任务日志都关联到该记录
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gocron/models"
+	"gocron/modules/app"
+	"gocron/modules/logger"
+)
+
+const skippedByUpstreamMessage = "skipped by upstream"
+
+// 工作流中任务的执行状态
+type workflowNode struct {
+	triggered bool // 已开始执行或已跳过
+	done      bool // 执行完成或已跳过
+	success   bool
+	result    upstreamResult
+}
+
+// 一次工作流运行, 只包含从根任务可到达的任务
+type workflowRun struct {
+	id          int64 // 运行记录ID
+	rootTaskId  int
+	root        RunContext                      // 根任务的运行信息, 下游任务使用相同的运行类型和计划执行时间
+	upstreams   map[int][]models.TaskDependency // 下游任务ID => 上游依赖
+	downstreams map[int][]int                   // 上游任务ID => 下游任务ID
+	tasks       map[int]models.Task
+	nodes       map[int]*workflowNode
+	ended       bool // 运行记录已结束
+	sync.Mutex
+}
+
+func newWorkflowRun(rootTaskId int, dependencies []models.TaskDependency) *workflowRun {
+	run := &workflowRun{
+		rootTaskId:  rootTaskId,
+		upstreams:   make(map[int][]models.TaskDependency),
+		downstreams: make(map[int][]int),
+		tasks:       make(map[int]models.Task),
+		nodes:       make(map[int]*workflowNode),
+	}
+	allDownstreams := make(map[int][]models.TaskDependency)
+	for _, item := range dependencies {
+		allDownstreams[item.UpstreamTaskId] = append(allDownstreams[item.UpstreamTaskId], item)
+	}
+	// 从根任务开始遍历, 不可到达的上游任务不参与本次运行
+	visited := map[int]bool{rootTaskId: true}
+	queue := []int{rootTaskId}
+	for len(queue) > 0 {
+		taskId := queue[0]
+		queue = queue[1:]
+		for _, item := range allDownstreams[taskId] {
+			run.upstreams[item.TaskId] = append(run.upstreams[item.TaskId], item)
+			run.downstreams[taskId] = append(run.downstreams[taskId], item.TaskId)
+			if !visited[item.TaskId] {
+				visited[item.TaskId] = true
+				queue = append(queue, item.TaskId)
+			}
+		}
+	}
+	run.nodes[rootTaskId] = &workflowNode{triggered: true}
+
+	return run
+}
+
+// 创建运行记录, 保存本次运行涉及的依赖关系用于展示运行树
+func (w *workflowRun) create(taskModel models.Task) error {
+	dependencies := make([]models.TaskDependency, 0)
+	for _, items := range w.upstreams {
+		dependencies = append(dependencies, items...)
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		return dependencies[i].Id < dependencies[j].Id
+	})
+	data, err := json.Marshal(dependencies)
+	if err != nil {
+		return err
+	}
+	runModel := &models.WorkflowRun{
+		TaskId:       taskModel.Id,
+		Name:         taskModel.Name,
+		Dependencies: string(data),
+		Instance:     app.InstanceId,
+		Status:       models.Running,
+	}
+	w.id, err = runModel.Create()
+
+	return err
+}
+
+// 所有任务完成后返回运行状态, 存在失败或跳过的任务时为失败
+func (w *workflowRun) aggregate() (status models.Status, done bool) {
+	w.Lock()
+	defer w.Unlock()
+	status = models.Finish
+	taskIds := []int{w.rootTaskId}
+	for taskId := range w.upstreams {
+		taskIds = append(taskIds, taskId)
+	}
+	for _, taskId := range taskIds {
+		node := w.node(taskId)
+		if !node.done {
+			return models.Running, false
+		}
+		if !node.success {
+			status = models.Failure
+		}
+	}
+
+	return status, true
+}
+
+// 结束运行记录, 只结束一次
+func (w *workflowRun) end(status models.Status) {
+	w.Lock()
+	ended := w.ended
+	w.ended = true
+	w.Unlock()
+	if ended || w.id <= 0 {
+		return
+	}
+	runModel := new(models.WorkflowRun)
+	_, err := runModel.Finish(w.id, status)
+	if err != nil {
+		logger.Errorf("更新工作流运行记录失败#运行记录ID-%d#%s", w.id, err.Error())
+	}
+}
+
+// 加载本次运行涉及的下游任务
+func (w *workflowRun) loadTasks() {
+	taskModel := new(models.Task)
+	for taskId := range w.upstreams {
+		task, err := taskModel.Detail(taskId)
+		if err != nil || task.Id <= 0 {
+			logger.Errorf("获取下游任务失败#上游任务ID-%d#任务ID-%d", w.rootTaskId, taskId)
+			continue
+		}
+		w.tasks[taskId] = task
+	}
+}
+
+// 任务完成, 返回需要执行和需要跳过的下游任务
+func (w *workflowRun) finish(taskId int, success bool) (runIds []int, skipIds []int) {
+	w.Lock()
+	defer w.Unlock()
+	node := w.node(taskId)
+	node.triggered = true
+	node.done = true
+	node.success = success
+	for _, downstreamId := range w.downstreams[taskId] {
+		downstream := w.node(downstreamId)
+		if downstream.triggered {
+			continue
+		}
+		ready, run := w.evaluate(downstreamId)
+		if !ready {
+			continue
+		}
+		downstream.triggered = true
+		if run {
+			runIds = append(runIds, downstreamId)
+		} else {
+			skipIds = append(skipIds, downstreamId)
+		}
+	}
+
+	return runIds, skipIds
+}
+
+// 按触发条件判断下游任务能否确定执行或跳过
+// 强依赖: 上游任务执行成功才满足; 弱依赖: 上游任务执行完成(含失败、跳过)即满足
+func (w *workflowRun) evaluate(taskId int) (ready bool, run bool) {
+	doneNum := 0
+	satisfiedNum := 0
+	upstreams := w.upstreams[taskId]
+	for _, item := range upstreams {
+		upstream := w.node(item.UpstreamTaskId)
+		if !upstream.done {
+			continue
+		}
+		doneNum++
+		if upstream.success || item.Status == models.TaskDependencyStatusWeak {
+			satisfiedNum++
+		}
+	}
+	if w.tasks[taskId].TriggerRule == models.TaskTriggerAnyDone {
+		if satisfiedNum > 0 {
+			return true, true
+		}
+		return doneNum == len(upstreams), false
+	}
+	if doneNum < len(upstreams) {
+		return false, false
+	}
+
+	return true, satisfiedNum == len(upstreams)
+}
+
+func (w *workflowRun) node(taskId int) *workflowNode {
+	node, ok := w.nodes[taskId]
+	if !ok {
+		node = &workflowNode{}
+		w.nodes[taskId] = node
+	}
+
+	return node
+}
+
+// 任务完成, 执行或跳过满足触发条件的下游任务
+func (w *workflowRun) complete(result upstreamResult) {
+	w.Lock()
+	w.node(result.TaskId).result = result
+	w.Unlock()
+	runIds, skipIds := w.finish(result.TaskId, result.Status == upstreamStatusSuccess)
+	for _, id := range skipIds {
+		w.skip(id)
+	}
+	for _, id := range runIds {
+		go w.run(id, w.upstreamContext(id, result.TaskId))
+	}
+	if status, done := w.aggregate(); done {
+		w.end(status)
+	}
+}
+
+// 下游任务可使用的上游任务信息, triggerTaskId为触发执行的上游任务
+func (w *workflowRun) upstreamContext(taskId int, triggerTaskId int) upstreamContext {
+	w.Lock()
+	defer w.Unlock()
+	upstream := upstreamContext{
+		upstreamResult: w.node(triggerTaskId).result,
+		Upstreams:      make(map[int]upstreamResult),
+	}
+	for _, item := range w.upstreams[taskId] {
+		node := w.node(item.UpstreamTaskId)
+		if node.done {
+			upstream.Upstreams[item.UpstreamTaskId] = node.result
+		}
+	}
+
+	return upstream
+}
+
+func (w *workflowRun) run(taskId int, upstream upstreamContext) {
+	failure := upstreamResult{TaskId: taskId, Status: upstreamStatusFailure}
+	taskModel, ok := w.tasks[taskId]
+	if !ok {
+		w.complete(failure)
+		return
+	}
+	handler := createHandler(taskModel)
+	if handler == nil {
+		logger.Error("创建任务处理Job失败,不支持的任务协议#", taskModel.Protocol)
+		w.complete(failure)
+		return
+	}
+	taskModel.Spec = w.spec(taskId)
+	runContext := RunContext{
+		Type:          w.root.Type,
+		ScheduledTime: w.root.ScheduledTime,
+		WorkflowRunId: w.id,
+		Location:      w.root.Location,
+		Upstream:      upstream,
+		Params:        w.root.Params,
+		LeaseToken:    w.root.LeaseToken,
+	}
+	taskResult := runJob(handler, taskModel, runContext)
+	runHooks(taskModel, taskResult, runContext)
+	// 应用退出, 不再执行下游任务
+	if taskResult.Interrupted {
+		w.end(models.Interrupted)
+		return
+	}
+	// 当前实例不再是主节点, 不再执行下游任务
+	if taskResult.Err == errLeaseLost {
+		w.end(models.Cancel)
+		return
+	}
+	w.complete(newUpstreamResult(taskId, taskResult))
+}
+
+// 上游依赖不满足, 跳过任务并继续处理其下游任务
+func (w *workflowRun) skip(taskId int) {
+	result := upstreamResult{TaskId: taskId, Status: upstreamStatusSkipped}
+	if taskModel, ok := w.tasks[taskId]; ok {
+		logger.Infof("上游任务依赖不满足, 跳过执行#任务ID-%d", taskId)
+		taskModel.Spec = w.spec(taskId)
+		result.LogId = createSkippedLog(taskModel, RunContext{
+			Type:          w.root.Type,
+			ScheduledTime: w.root.ScheduledTime,
+			WorkflowRunId: w.id,
+		}, skippedByUpstreamMessage)
+		result.Result = skippedByUpstreamMessage
+	}
+	w.complete(result)
+}
+
+func (w *workflowRun) spec(taskId int) string {
+	ids := make([]string, len(w.upstreams[taskId]))
+	for i, item := range w.upstreams[taskId] {
+		ids[i] = strconv.Itoa(item.UpstreamTaskId)
+	}
+
+	return fmt.Sprintf("依赖任务(上游任务ID-%s)", strings.Join(ids, ","))
+}
+
+// 执行任务, 存在下游任务时以该任务为起点运行工作流
+func runWorkflow(handler Handler, taskModel models.Task, runContext RunContext) {
+	if runContext.Location == nil {
+		runContext.Location, _ = LoadLocation(taskModel.Timezone)
+	}
+	run := createWorkflowRun(taskModel)
+	if run == nil {
+		taskResult := runJob(handler, taskModel, runContext)
+		runHooks(taskModel, taskResult, runContext)
+		return
+	}
+	runContext.WorkflowRunId = run.id
+	run.root = runContext
+	taskResult := runJob(handler, taskModel, runContext)
+	runHooks(taskModel, taskResult, runContext)
+	switch {
+	case taskResult.Interrupted:
+		// 应用退出, 不再执行下游任务
+		run.end(models.Interrupted)
+		return
+	case taskResult.Err == errOverlapSkipped || taskResult.Err == errLeaseLost || taskResult.Replaced:
+		// 根任务未执行或被新的执行终止, 不执行下游任务
+		run.end(models.Cancel)
+		return
+	case taskResult.Err == errCreateTaskLog:
+		run.end(models.Failure)
+		return
+	}
+	run.loadTasks()
+	run.complete(newUpstreamResult(taskModel.Id, taskResult))
+}
+
+// 任务存在下游任务时创建工作流运行, 否则返回nil
+func createWorkflowRun(taskModel models.Task) *workflowRun {
+	dependencies, err := loadWorkflowDependencies(taskModel.Id)
+	if err != nil {
+		logger.Errorf("获取任务依赖关系失败#任务ID-%d#%s", taskModel.Id, err.Error())
+		return nil
+	}
+	run := newWorkflowRun(taskModel.Id, dependencies)
+	if len(run.downstreams[taskModel.Id]) == 0 {
+		return nil
+	}
+	// 运行记录创建失败不影响任务执行
+	err = run.create(taskModel)
+	if err != nil {
+		logger.Errorf("创建工作流运行记录失败#任务ID-%d#%s", taskModel.Id, err.Error())
+	}
+
+	return run
+}
+
+// 从根任务开始按层级查询下游依赖, 只加载本次运行涉及的依赖关系, 没有下游任务时只查询一次
+func loadWorkflowDependencies(rootTaskId int) ([]models.TaskDependency, error) {
+	dependencyModel := new(models.TaskDependency)
+	dependencies := make([]models.TaskDependency, 0)
+	visited := map[int]bool{rootTaskId: true}
+	upstreamIds := []int{rootTaskId}
+	for len(upstreamIds) > 0 {
+		list, err := dependencyModel.ListByUpstreamIds(upstreamIds)
+		if err != nil {
+			return nil, err
+		}
+		upstreamIds = upstreamIds[:0]
+		for _, item := range list {
+			dependencies = append(dependencies, item)
+			if !visited[item.TaskId] {
+				visited[item.TaskId] = true
+				upstreamIds = append(upstreamIds, item.TaskId)
+			}
+		}
+	}
+
+	return dependencies, nil
+}
+
+// 工作流运行中的任务, 用于展示运行树
+type WorkflowNode struct {
+	TaskId          int
+	Name            string
+	Depth           int   // 层级, 根任务为0
+	UpstreamTaskIds []int // 本次运行中的上游任务
+	LogId           int64 // 任务日志ID, 0表示未执行
+	Status          models.Status
+	StartTime       time.Time
+	EndTime         time.Time
+	TotalTime       int // 执行时长(秒)
+}
+
+// 按运行记录中的依赖关系和任务日志生成运行树, 按先序遍历顺序返回
+// 任务有多个上游任务时, 挂在层级最深的上游任务下, 层级为距根任务的最长路径
+func WorkflowNodes(run models.WorkflowRun, logs []models.TaskLog) ([]WorkflowNode, error) {
+	dependencies := make([]models.TaskDependency, 0)
+	if run.Dependencies != "" {
+		err := json.Unmarshal([]byte(run.Dependencies), &dependencies)
+		if err != nil {
+			return nil, err
+		}
+	}
+	upstreams := make(map[int][]int)
+	downstreams := make(map[int][]int)
+	indegrees := make(map[int]int)
+	for _, item := range dependencies {
+		upstreams[item.TaskId] = append(upstreams[item.TaskId], item.UpstreamTaskId)
+		downstreams[item.UpstreamTaskId] = append(downstreams[item.UpstreamTaskId], item.TaskId)
+		indegrees[item.TaskId]++
+	}
+
+	// 按拓扑顺序计算层级
+	depths := map[int]int{run.TaskId: 0}
+	queue := []int{run.TaskId}
+	for len(queue) > 0 {
+		taskId := queue[0]
+		queue = queue[1:]
+		for _, downstreamId := range downstreams[taskId] {
+			if depths[taskId]+1 > depths[downstreamId] {
+				depths[downstreamId] = depths[taskId] + 1
+			}
+			indegrees[downstreamId]--
+			if indegrees[downstreamId] == 0 {
+				queue = append(queue, downstreamId)
+			}
+		}
+	}
+	children := make(map[int][]int)
+	for taskId, upstreamIds := range upstreams {
+		for _, upstreamId := range upstreamIds {
+			if depths[upstreamId] == depths[taskId]-1 {
+				children[upstreamId] = append(children[upstreamId], taskId)
+				break
+			}
+		}
+	}
+	for _, items := range children {
+		sort.Ints(items)
+	}
+
+	taskLogs := make(map[int]models.TaskLog)
+	for _, item := range logs {
+		// 失败或成功处理任务不在运行树中
+		if item.Type == models.TaskTypeHook {
+			continue
+		}
+		taskLogs[item.TaskId] = item
+	}
+	nodes := make([]WorkflowNode, 0, len(depths))
+	var walk func(taskId int)
+	walk = func(taskId int) {
+		node := WorkflowNode{
+			TaskId:          taskId,
+			Depth:           depths[taskId],
+			UpstreamTaskIds: upstreams[taskId],
+		}
+		if taskLog, ok := taskLogs[taskId]; ok {
+			node.Name = taskLog.Name
+			node.LogId = taskLog.Id
+			node.Status = taskLog.Status
+			node.StartTime = taskLog.StartTime
+			node.EndTime = taskLog.EndTime
+			node.TotalTime = taskLog.TotalTime
+		}
+		nodes = append(nodes, node)
+		for _, childId := range children[taskId] {
+			walk(childId)
+		}
+	}
+	walk(run.TaskId)
+
+	return nodes, nil
+}
+
+// 为任务设置上游依赖后是否形成环, 形成环时返回环上的任务ID
+func DependencyCycle(dependencies []models.TaskDependency, taskId int, upstreamIds []int) []int {
+	downstreams := make(map[int][]int)
+	for _, item := range dependencies {
+		if item.TaskId == taskId {
+			continue
+		}
+		downstreams[item.UpstreamTaskId] = append(downstreams[item.UpstreamTaskId], item.TaskId)
+	}
+	for _, upstreamId := range upstreamIds {
+		downstreams[upstreamId] = append(downstreams[upstreamId], taskId)
+	}
+
+	// 从任务出发沿下游遍历, 能回到任务自身即形成环
+	visited := make(map[int]bool)
+	var path []int
+	var walk func(id int) bool
+	walk = func(id int) bool {
+		path = append(path, id)
+		for _, downstreamId := range downstreams[id] {
+			if downstreamId == taskId {
+				path = append(path, taskId)
+				return true
+			}
+			if visited[downstreamId] {
+				continue
+			}
+			visited[downstreamId] = true
+			if walk(downstreamId) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+
+		return false
+	}
+	if walk(taskId) {
+		return path
+	}
+
+	return nil
+}
+
+// 为任务设置上游依赖后, 是否存在上游任务来自多个根任务的汇聚任务
+// 工作流从触发执行的根任务开始遍历, 来自其他根任务的上游依赖不参与本次运行, 汇聚任务无法等待所有上游任务, 不允许设置
+// 只检查任务自身及其下游任务, 存在时返回汇聚任务ID及其根任务ID, 不存在时rootIds为空
+func DependencyMultiRoot(dependencies []models.TaskDependency, taskId int, upstreamIds []int) (fanInTaskId int, rootIds []int) {
+	upstreams := make(map[int][]int)
+	downstreams := make(map[int][]int)
+	for _, item := range dependencies {
+		if item.TaskId == taskId {
+			continue
+		}
+		upstreams[item.TaskId] = append(upstreams[item.TaskId], item.UpstreamTaskId)
+		downstreams[item.UpstreamTaskId] = append(downstreams[item.UpstreamTaskId], item.TaskId)
+	}
+	if len(upstreamIds) > 0 {
+		upstreams[taskId] = upstreamIds
+	}
+
+	// 任务可到达的根任务, 没有上游依赖的任务为根任务
+	roots := make(map[int]map[int]bool)
+	var walk func(id int) map[int]bool
+	walk = func(id int) map[int]bool {
+		if result, ok := roots[id]; ok {
+			return result
+		}
+		result := make(map[int]bool)
+		roots[id] = result
+		if len(upstreams[id]) == 0 {
+			result[id] = true
+			return result
+		}
+		for _, upstreamId := range upstreams[id] {
+			for rootId := range walk(upstreamId) {
+				result[rootId] = true
+			}
+		}
+
+		return result
+	}
+
+	visited := map[int]bool{taskId: true}
+	queue := []int{taskId}
+	taskIds := make([]int, 0)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		taskIds = append(taskIds, id)
+		for _, downstreamId := range downstreams[id] {
+			if !visited[downstreamId] {
+				visited[downstreamId] = true
+				queue = append(queue, downstreamId)
+			}
+		}
+	}
+	sort.Ints(taskIds)
+	for _, id := range taskIds {
+		if len(upstreams[id]) < 2 {
+			continue
+		}
+		result := walk(id)
+		if len(result) < 2 {
+			continue
+		}
+		for rootId := range result {
+			rootIds = append(rootIds, rootId)
+		}
+		sort.Ints(rootIds)
+		return id, rootIds
+	}
+
+	return 0, nil
+}
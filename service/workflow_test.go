@@ -0,0 +1,209 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gocron/models"
+)
+
+func dependency(upstreamTaskId, taskId int, status models.TaskDependencyStatus) models.TaskDependency {
+	return models.TaskDependency{TaskId: taskId, UpstreamTaskId: upstreamTaskId, Status: status}
+}
+
+func TestWorkflowRunChain(t *testing.T) {
+	strong := models.TaskDependencyStatusStrong
+	weak := models.TaskDependencyStatusWeak
+	// 1 -> 2 -> 3, 1 -(弱)-> 4, 5 -> 6 不可到达
+	run := newWorkflowRun(1, []models.TaskDependency{
+		dependency(1, 2, strong),
+		dependency(2, 3, strong),
+		dependency(1, 4, weak),
+		dependency(5, 6, strong),
+	})
+	if _, ok := run.upstreams[6]; ok {
+		t.Fatal("不可到达的任务不应参与运行")
+	}
+
+	runIds, skipIds := run.finish(1, false)
+	if !reflect.DeepEqual(runIds, []int{4}) || !reflect.DeepEqual(skipIds, []int{2}) {
+		t.Fatalf("强依赖上游失败应跳过, 弱依赖应执行, 实际执行%v, 跳过%v", runIds, skipIds)
+	}
+	runIds, skipIds = run.finish(2, false)
+	if len(runIds) != 0 || !reflect.DeepEqual(skipIds, []int{3}) {
+		t.Fatalf("跳过应向下游传递, 实际执行%v, 跳过%v", runIds, skipIds)
+	}
+}
+
+func TestWorkflowRunFanIn(t *testing.T) {
+	strong := models.TaskDependencyStatusStrong
+	// 1 -> 2, 1 -> 3, 2 -> 4, 3 -> 4
+	dependencies := []models.TaskDependency{
+		dependency(1, 2, strong),
+		dependency(1, 3, strong),
+		dependency(2, 4, strong),
+		dependency(3, 4, strong),
+	}
+
+	run := newWorkflowRun(1, dependencies)
+	run.finish(1, true)
+	runIds, skipIds := run.finish(2, true)
+	if len(runIds) != 0 || len(skipIds) != 0 {
+		t.Fatal("所有上游任务完成前不应触发")
+	}
+	runIds, _ = run.finish(3, true)
+	if !reflect.DeepEqual(runIds, []int{4}) {
+		t.Fatalf("所有上游任务成功后应执行, 实际%v", runIds)
+	}
+
+	run = newWorkflowRun(1, dependencies)
+	run.finish(1, true)
+	run.finish(2, false)
+	runIds, skipIds = run.finish(3, true)
+	if len(runIds) != 0 || !reflect.DeepEqual(skipIds, []int{4}) {
+		t.Fatalf("强依赖上游失败应跳过, 实际执行%v, 跳过%v", runIds, skipIds)
+	}
+
+	run = newWorkflowRun(1, dependencies)
+	run.tasks[4] = models.Task{Id: 4, TriggerRule: models.TaskTriggerAnyDone}
+	run.finish(1, true)
+	runIds, _ = run.finish(2, true)
+	if !reflect.DeepEqual(runIds, []int{4}) {
+		t.Fatalf("任一上游任务成功后应执行, 实际%v", runIds)
+	}
+	runIds, skipIds = run.finish(3, true)
+	if len(runIds) != 0 || len(skipIds) != 0 {
+		t.Fatal("同一次运行中任务只执行一次")
+	}
+
+	run = newWorkflowRun(1, dependencies)
+	run.tasks[4] = models.Task{Id: 4, TriggerRule: models.TaskTriggerAnyDone}
+	run.finish(1, true)
+	run.finish(2, false)
+	runIds, skipIds = run.finish(3, false)
+	if len(runIds) != 0 || !reflect.DeepEqual(skipIds, []int{4}) {
+		t.Fatalf("所有上游依赖均不满足应跳过, 实际执行%v, 跳过%v", runIds, skipIds)
+	}
+}
+
+func TestWorkflowRunAggregate(t *testing.T) {
+	strong := models.TaskDependencyStatusStrong
+	// 1 -> 2 -> 3
+	run := newWorkflowRun(1, []models.TaskDependency{
+		dependency(1, 2, strong),
+		dependency(2, 3, strong),
+	})
+	run.finish(1, true)
+	if _, done := run.aggregate(); done {
+		t.Fatal("存在未完成的任务, 运行不应结束")
+	}
+	run.finish(2, true)
+	run.finish(3, true)
+	if status, done := run.aggregate(); !done || status != models.Finish {
+		t.Fatalf("所有任务成功, 运行应完成, 实际%v-%v", done, status)
+	}
+
+	run = newWorkflowRun(1, []models.TaskDependency{
+		dependency(1, 2, strong),
+		dependency(2, 3, strong),
+	})
+	run.finish(1, true)
+	_, skipIds := run.finish(2, false)
+	run.finish(skipIds[0], false)
+	if status, done := run.aggregate(); !done || status != models.Failure {
+		t.Fatalf("存在失败或跳过的任务, 运行应失败, 实际%v-%v", done, status)
+	}
+}
+
+func TestWorkflowNodes(t *testing.T) {
+	strong := models.TaskDependencyStatusStrong
+	// 1 -> 2 -> 4, 1 -> 3 -> 4, 2 -> 3
+	dependencies := []models.TaskDependency{
+		dependency(1, 2, strong),
+		dependency(1, 3, strong),
+		dependency(2, 4, strong),
+		dependency(3, 4, strong),
+		dependency(2, 3, strong),
+	}
+	for i := range dependencies {
+		dependencies[i].Id = i + 1
+	}
+	data, _ := json.Marshal(dependencies)
+	run := models.WorkflowRun{TaskId: 1, Dependencies: string(data)}
+	logs := []models.TaskLog{
+		{Id: 10, TaskId: 1, Name: "root", Status: models.Finish, TotalTime: 3},
+		{Id: 11, TaskId: 2, Name: "child", Status: models.Failure},
+		{Id: 12, TaskId: 3, Name: "skipped", Status: models.Skipped},
+	}
+	nodes, err := WorkflowNodes(run, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskIds := make([]int, len(nodes))
+	depths := make([]int, len(nodes))
+	for i, node := range nodes {
+		taskIds[i] = node.TaskId
+		depths[i] = node.Depth
+	}
+	if !reflect.DeepEqual(taskIds, []int{1, 2, 3, 4}) || !reflect.DeepEqual(depths, []int{0, 1, 2, 3}) {
+		t.Fatalf("运行树顺序或层级错误, 任务%v, 层级%v", taskIds, depths)
+	}
+	if nodes[0].LogId != 10 || nodes[0].TotalTime != 3 || nodes[2].Status != models.Skipped {
+		t.Fatalf("任务日志关联错误-%+v", nodes)
+	}
+	if nodes[3].LogId != 0 || !reflect.DeepEqual(nodes[3].UpstreamTaskIds, []int{2, 3}) {
+		t.Fatalf("未执行任务错误-%+v", nodes[3])
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	strong := models.TaskDependencyStatusStrong
+	// 1 -> 2 -> 3
+	dependencies := []models.TaskDependency{
+		dependency(1, 2, strong),
+		dependency(2, 3, strong),
+	}
+	if cycle := DependencyCycle(dependencies, 3, []int{1, 2}); cycle != nil {
+		t.Fatalf("不应存在环, 实际%v", cycle)
+	}
+	cycle := DependencyCycle(dependencies, 1, []int{3})
+	if !reflect.DeepEqual(cycle, []int{1, 2, 3, 1}) {
+		t.Fatalf("应检测到环1->2->3->1, 实际%v", cycle)
+	}
+	// 修改任务2的上游依赖时忽略原有依赖
+	if cycle := DependencyCycle(dependencies, 2, []int{1}); cycle != nil {
+		t.Fatalf("不应存在环, 实际%v", cycle)
+	}
+	if cycle := DependencyCycle(dependencies, 2, []int{3}); cycle == nil {
+		t.Fatal("应检测到环2->3->2")
+	}
+}
+
+func TestDependencyMultiRoot(t *testing.T) {
+	strong := models.TaskDependencyStatusStrong
+	// 1 -> 2 -> 4, 1 -> 3 -> 4, 5为独立调度的根任务
+	dependencies := []models.TaskDependency{
+		dependency(1, 2, strong),
+		dependency(1, 3, strong),
+		dependency(2, 4, strong),
+		dependency(3, 4, strong),
+	}
+	if taskId, rootIds := DependencyMultiRoot(dependencies, 4, []int{2, 3}); len(rootIds) > 0 {
+		t.Fatalf("同一根任务的汇聚任务应允许, 实际%d-%v", taskId, rootIds)
+	}
+	// 两个独立的根任务汇聚到同一任务
+	taskId, rootIds := DependencyMultiRoot(dependencies, 6, []int{1, 5})
+	if taskId != 6 || !reflect.DeepEqual(rootIds, []int{1, 5}) {
+		t.Fatalf("应检测到任务6的上游来自根任务1、5, 实际%d-%v", taskId, rootIds)
+	}
+	// 修改任务3的上游依赖后, 下游汇聚任务4的上游来自多个根任务
+	taskId, rootIds = DependencyMultiRoot(dependencies, 3, []int{5})
+	if taskId != 4 || !reflect.DeepEqual(rootIds, []int{1, 5}) {
+		t.Fatalf("应检测到任务4的上游来自根任务1、5, 实际%d-%v", taskId, rootIds)
+	}
+	// 新增任务, 任务ID为0
+	if _, rootIds := DependencyMultiRoot(dependencies, 0, []int{1, 5}); len(rootIds) == 0 {
+		t.Fatal("新增任务的上游来自多个根任务时应检测到")
+	}
+}